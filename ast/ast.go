@@ -3,12 +3,14 @@ package ast
 import (
 	"bytes"
 	"mana/tokens"
+	"math/big"
 	"strings"
 )
 
 type Node interface {
 	TokenLiteral() string
 	String() string
+	Pos() tokens.Position // position of the node's token in the source
 }
 
 type Statement interface {
@@ -35,6 +37,15 @@ func (p *Program) TokenLiteral() string {
 	return ""
 }
 
+// Pos returns the position of the program's first statement.
+
+func (p *Program) Pos() tokens.Position {
+	if len(p.Statements) > 0 {
+		return p.Statements[0].Pos()
+	}
+	return tokens.Position{}
+}
+
 // String returns a string representation of the program. This is used only for
 // debugging and testing.
 
@@ -53,12 +64,16 @@ type LetStatement struct {
 	Token tokens.Token // the token.LET token
 	Name  *Identifier
 	Value Expression
+	Doc   string // text of the /// comments in front of the statement, if any
 }
 
 func (ls *LetStatement) statementNode() {}
 func (ls *LetStatement) TokenLiteral() string {
 	return ls.Token.Literal
 }
+func (ls *LetStatement) Pos() tokens.Position {
+	return ls.Token.Pos
+}
 func (ls *LetStatement) String() string {
 	var out bytes.Buffer
 
@@ -75,6 +90,38 @@ func (ls *LetStatement) String() string {
 	return out.String()
 }
 
+// ConstStatement represents a const statement, which binds a name that cannot
+// be reassigned or redeclared in the same scope.
+type ConstStatement struct {
+	Token tokens.Token // the token.CONST token
+	Name  *Identifier
+	Value Expression
+	Doc   string // text of the /// comments in front of the statement, if any
+}
+
+func (cs *ConstStatement) statementNode() {}
+func (cs *ConstStatement) TokenLiteral() string {
+	return cs.Token.Literal
+}
+func (cs *ConstStatement) Pos() tokens.Position {
+	return cs.Token.Pos
+}
+func (cs *ConstStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString(cs.TokenLiteral() + " ")
+	out.WriteString(cs.Name.String())
+	out.WriteString(" = ")
+
+	if cs.Value != nil {
+		out.WriteString(cs.Value.String())
+	}
+
+	out.WriteString(";")
+
+	return out.String()
+}
+
 // Identifier represents an identifier.
 type Identifier struct {
 	Token tokens.Token // the token.IDENT token
@@ -85,6 +132,9 @@ func (i *Identifier) expressionNode() {}
 func (i *Identifier) TokenLiteral() string {
 	return i.Token.Literal
 }
+func (i *Identifier) Pos() tokens.Position {
+	return i.Token.Pos
+}
 func (i *Identifier) String() string {
 	return i.Value
 }
@@ -97,6 +147,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) statementNode()       {}
 func (bs *BlockStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BlockStatement) Pos() tokens.Position { return bs.Token.Pos }
 func (bs *BlockStatement) String() string {
 	var out bytes.Buffer
 
@@ -117,6 +168,9 @@ func (rs *ReturnStatement) statementNode() {}
 func (rs *ReturnStatement) TokenLiteral() string {
 	return rs.Token.Literal
 }
+func (rs *ReturnStatement) Pos() tokens.Position {
+	return rs.Token.Pos
+}
 func (rs *ReturnStatement) String() string {
 	var out bytes.Buffer
 
@@ -141,6 +195,9 @@ func (es *ExpressionStatement) statementNode() {}
 func (es *ExpressionStatement) TokenLiteral() string {
 	return es.Token.Literal
 }
+func (es *ExpressionStatement) Pos() tokens.Position {
+	return es.Token.Pos
+}
 func (es *ExpressionStatement) String() string {
 	if es.Expression != nil {
 		return es.Expression.String()
@@ -159,6 +216,9 @@ func (pe *PrefixExpression) expressionNode() {}
 func (pe *PrefixExpression) TokenLiteral() string {
 	return pe.Token.Literal
 }
+func (pe *PrefixExpression) Pos() tokens.Position {
+	return pe.Token.Pos
+}
 func (pe *PrefixExpression) String() string {
 	var out bytes.Buffer
 
@@ -183,6 +243,9 @@ func (ie *InfixExpression) expressionNode() {}
 func (ie *InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
+func (ie *InfixExpression) Pos() tokens.Position {
+	return ie.Token.Pos
+}
 func (ie *InfixExpression) String() string {
 	var out bytes.Buffer
 
@@ -195,20 +258,84 @@ func (ie *InfixExpression) String() string {
 	return out.String()
 }
 
+// AssignExpression represents an assignment to an existing variable or to an
+// element of an array or hash, e.g. x = 5, x += 1 or xs[0] = 5. Operator is
+// "=" or a compound assignment operator such as "+=".
+type AssignExpression struct {
+	Token    tokens.Token // the assignment operator token
+	Target   Expression   // Identifier or IndexExpression
+	Operator string
+	Value    Expression
+}
+
+func (ae *AssignExpression) expressionNode()      {}
+func (ae *AssignExpression) TokenLiteral() string { return ae.Token.Literal }
+func (ae *AssignExpression) Pos() tokens.Position { return ae.Token.Pos }
+func (ae *AssignExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ae.Target.String())
+	out.WriteString(" " + ae.Operator + " ")
+	out.WriteString(ae.Value.String())
+	out.WriteString(")")
+
+	return out.String()
+}
+
 // IntegerLiteral represents an integer literal.
 type IntegerLiteral struct {
 	Token tokens.Token // the token.INT token
 	Value int64
+	Big   *big.Int // the value if it does not fit in an int64, otherwise nil
 }
 
 func (il *IntegerLiteral) expressionNode() {}
 func (il *IntegerLiteral) TokenLiteral() string {
 	return il.Token.Literal
 }
+func (il *IntegerLiteral) Pos() tokens.Position {
+	return il.Token.Pos
+}
 func (il *IntegerLiteral) String() string {
 	return il.Token.Literal
 }
 
+// FloatLiteral represents a floating-point literal.
+type FloatLiteral struct {
+	Token tokens.Token // the token.FLOAT token
+	Value float64
+}
+
+func (fl *FloatLiteral) expressionNode() {}
+func (fl *FloatLiteral) TokenLiteral() string {
+	return fl.Token.Literal
+}
+func (fl *FloatLiteral) Pos() tokens.Position {
+	return fl.Token.Pos
+}
+func (fl *FloatLiteral) String() string {
+	return fl.Token.Literal
+}
+
+// StringLiteral represents a string literal. The token literal holds the
+// decoded contents, without the surrounding quotes.
+type StringLiteral struct {
+	Token tokens.Token // the token.STRING token
+	Value string
+}
+
+func (sl *StringLiteral) expressionNode() {}
+func (sl *StringLiteral) TokenLiteral() string {
+	return sl.Token.Literal
+}
+func (sl *StringLiteral) Pos() tokens.Position {
+	return sl.Token.Pos
+}
+func (sl *StringLiteral) String() string {
+	return sl.Token.Literal
+}
+
 type Boolean struct {
 	Token tokens.Token
 	Value bool
@@ -218,6 +345,9 @@ func (b *Boolean) expressionNode() {}
 func (b *Boolean) TokenLiteral() string {
 	return b.Token.Literal
 }
+func (b *Boolean) Pos() tokens.Position {
+	return b.Token.Pos
+}
 func (b *Boolean) String() string {
 	return b.Token.Literal
 }
@@ -231,6 +361,7 @@ type IfExpression struct {
 
 func (ie *IfExpression) expressionNode()      {}
 func (ie *IfExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IfExpression) Pos() tokens.Position { return ie.Token.Pos }
 func (ie *IfExpression) String() string {
 	var out bytes.Buffer
 
@@ -255,6 +386,7 @@ type FunctionLiteral struct {
 
 func (fl *FunctionLiteral) expressionNode()      {}
 func (fl *FunctionLiteral) TokenLiteral() string { return fl.Token.Literal }
+func (fl *FunctionLiteral) Pos() tokens.Position { return fl.Token.Pos }
 func (fl *FunctionLiteral) String() string {
 	var out bytes.Buffer
 
@@ -273,6 +405,117 @@ func (fl *FunctionLiteral) String() string {
 	return out.String()
 }
 
+// ArrayLiteral represents an array literal, e.g. [1, 2, 3].
+type ArrayLiteral struct {
+	Token    tokens.Token // the '[' token
+	Elements []Expression
+}
+
+func (al *ArrayLiteral) expressionNode()      {}
+func (al *ArrayLiteral) TokenLiteral() string { return al.Token.Literal }
+func (al *ArrayLiteral) Pos() tokens.Position { return al.Token.Pos }
+func (al *ArrayLiteral) String() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+
+	for _, el := range al.Elements {
+		elements = append(elements, el.String())
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// IndexExpression represents an index expression, e.g. myArray[0].
+type IndexExpression struct {
+	Token tokens.Token // the '[' token
+	Left  Expression
+	Index Expression
+}
+
+func (ie *IndexExpression) expressionNode()      {}
+func (ie *IndexExpression) TokenLiteral() string { return ie.Token.Literal }
+func (ie *IndexExpression) Pos() tokens.Position { return ie.Token.Pos }
+func (ie *IndexExpression) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("(")
+	out.WriteString(ie.Left.String())
+	out.WriteString("[")
+	out.WriteString(ie.Index.String())
+	out.WriteString("])")
+
+	return out.String()
+}
+
+// HashLiteral represents a hash literal, e.g. {"key": "value"}. Pairs are
+// kept in source order.
+type HashLiteral struct {
+	Token tokens.Token // the '{' token
+	Pairs []HashLiteralPair
+}
+
+// HashLiteralPair is a single key: value entry of a HashLiteral.
+type HashLiteralPair struct {
+	Key   Expression
+	Value Expression
+}
+
+func (hl *HashLiteral) expressionNode()      {}
+func (hl *HashLiteral) TokenLiteral() string { return hl.Token.Literal }
+func (hl *HashLiteral) Pos() tokens.Position { return hl.Token.Pos }
+func (hl *HashLiteral) String() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
+
+// FunctionStatement represents a named function declaration, e.g.
+// fn add(x, y) { x + y }. It binds the function to its name in the current
+// scope.
+type FunctionStatement struct {
+	Token    tokens.Token // the 'fn' token
+	Name     *Identifier
+	Function *FunctionLiteral
+	Doc      string // text of the /// comments in front of the declaration, if any
+}
+
+func (fs *FunctionStatement) statementNode()       {}
+func (fs *FunctionStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *FunctionStatement) Pos() tokens.Position { return fs.Token.Pos }
+func (fs *FunctionStatement) String() string {
+	var out bytes.Buffer
+
+	params := []string{}
+
+	for _, p := range fs.Function.Parameters {
+		params = append(params, p.String())
+	}
+
+	out.WriteString(fs.TokenLiteral() + " ")
+	out.WriteString(fs.Name.String())
+	out.WriteString("(")
+	out.WriteString(strings.Join(params, ", "))
+	out.WriteString(")")
+	out.WriteString(fs.Function.Body.String())
+
+	return out.String()
+}
+
 type CallExpression struct {
 	Token     tokens.Token // the '(' token
 	Function  Expression   // Identifier or FunctionLiteral
@@ -281,6 +524,7 @@ type CallExpression struct {
 
 func (ce *CallExpression) expressionNode()      {}
 func (ce *CallExpression) TokenLiteral() string { return ce.Token.Literal }
+func (ce *CallExpression) Pos() tokens.Position { return ce.Token.Pos }
 func (ce *CallExpression) String() string {
 	var out bytes.Buffer
 
@@ -297,3 +541,106 @@ func (ce *CallExpression) String() string {
 
 	return out.String()
 }
+
+// WhileStatement represents a loop that runs its body for as long as its
+// condition is truthy, e.g. while (x < 10) { ... }.
+type WhileStatement struct {
+	Token     tokens.Token // the 'while' token
+	Condition Expression
+	Body      *BlockStatement
+}
+
+func (ws *WhileStatement) statementNode()       {}
+func (ws *WhileStatement) TokenLiteral() string { return ws.Token.Literal }
+func (ws *WhileStatement) Pos() tokens.Position { return ws.Token.Pos }
+func (ws *WhileStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("while (")
+	out.WriteString(ws.Condition.String())
+	out.WriteString(") ")
+	out.WriteString(ws.Body.String())
+
+	return out.String()
+}
+
+// ForStatement represents a C-style loop, e.g.
+// for (let i = 0; i < 10; i = i + 1) { ... }. Init, Condition and Update are
+// all optional; a missing condition is always true.
+type ForStatement struct {
+	Token     tokens.Token // the 'for' token
+	Init      Statement
+	Condition Expression
+	Update    Statement
+	Body      *BlockStatement
+}
+
+func (fs *ForStatement) statementNode()       {}
+func (fs *ForStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForStatement) Pos() tokens.Position { return fs.Token.Pos }
+func (fs *ForStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	if fs.Init != nil {
+		out.WriteString(strings.TrimSuffix(fs.Init.String(), ";"))
+	}
+	out.WriteString("; ")
+	if fs.Condition != nil {
+		out.WriteString(fs.Condition.String())
+	}
+	out.WriteString("; ")
+	if fs.Update != nil {
+		out.WriteString(strings.TrimSuffix(fs.Update.String(), ";"))
+	}
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// ForInStatement represents a loop over the elements of an array, the keys
+// of a hash or the characters of a string, e.g. for (x in xs) { ... }.
+type ForInStatement struct {
+	Token    tokens.Token // the 'for' token
+	Variable *Identifier
+	Iterable Expression
+	Body     *BlockStatement
+}
+
+func (fs *ForInStatement) statementNode()       {}
+func (fs *ForInStatement) TokenLiteral() string { return fs.Token.Literal }
+func (fs *ForInStatement) Pos() tokens.Position { return fs.Token.Pos }
+func (fs *ForInStatement) String() string {
+	var out bytes.Buffer
+
+	out.WriteString("for (")
+	out.WriteString(fs.Variable.String())
+	out.WriteString(" in ")
+	out.WriteString(fs.Iterable.String())
+	out.WriteString(") ")
+	out.WriteString(fs.Body.String())
+
+	return out.String()
+}
+
+// BreakStatement ends the innermost enclosing loop.
+type BreakStatement struct {
+	Token tokens.Token // the 'break' token
+}
+
+func (bs *BreakStatement) statementNode()       {}
+func (bs *BreakStatement) TokenLiteral() string { return bs.Token.Literal }
+func (bs *BreakStatement) Pos() tokens.Position { return bs.Token.Pos }
+func (bs *BreakStatement) String() string       { return bs.Token.Literal + ";" }
+
+// ContinueStatement skips to the next iteration of the innermost enclosing
+// loop.
+type ContinueStatement struct {
+	Token tokens.Token // the 'continue' token
+}
+
+func (cs *ContinueStatement) statementNode()       {}
+func (cs *ContinueStatement) TokenLiteral() string { return cs.Token.Literal }
+func (cs *ContinueStatement) Pos() tokens.Position { return cs.Token.Pos }
+func (cs *ContinueStatement) String() string       { return cs.Token.Literal + ";" }
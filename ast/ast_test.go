@@ -2,6 +2,7 @@ package ast
 
 import (
 	"mana/tokens"
+	"math/big"
 	"testing"
 )
 
@@ -26,3 +27,44 @@ func TestString(t *testing.T) {
 		t.Errorf("program.String() wrong. got=%q", program.String())
 	}
 }
+
+func TestDump(t *testing.T) {
+	var program = &Program{
+		Statements: []Statement{
+			&LetStatement{
+				Token: tokens.Token{Type: tokens.LET, Literal: "let", Pos: tokens.Position{Line: 1, Column: 1}},
+				Name: &Identifier{
+					Token: tokens.Token{Type: tokens.IDENT, Literal: "xs", Pos: tokens.Position{Line: 1, Column: 5}},
+					Value: "xs",
+				},
+				Value: &ArrayLiteral{
+					Token: tokens.Token{Type: tokens.LBRACKET, Literal: "[", Pos: tokens.Position{Line: 1, Column: 10}},
+					Elements: []Expression{
+						&IntegerLiteral{
+							Token: tokens.Token{Type: tokens.INT, Literal: "1", Pos: tokens.Position{Line: 1, Column: 11}},
+							Value: 1,
+						},
+						&IntegerLiteral{
+							Token: tokens.Token{Type: tokens.INT, Literal: "100000000000000000000", Pos: tokens.Position{Line: 1, Column: 14}},
+							Big:   new(big.Int).Exp(big.NewInt(10), big.NewInt(20), nil),
+						},
+					},
+				},
+			},
+		},
+	}
+
+	expected := `Program 1:1
+  Statements:
+    LetStatement 1:1
+      Name: Identifier 1:5 Value="xs"
+      Value: ArrayLiteral 1:10
+        Elements:
+          IntegerLiteral 1:11 Value=1
+          IntegerLiteral 1:14 Value=0 Big=100000000000000000000
+`
+
+	if got := Dump(program); got != expected {
+		t.Errorf("Dump(program) wrong.\nwant=%q\ngot=%q", expected, got)
+	}
+}
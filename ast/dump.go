@@ -0,0 +1,93 @@
+package ast
+
+import (
+	"bytes"
+	"fmt"
+	"mana/tokens"
+	"math/big"
+	"reflect"
+	"strings"
+)
+
+var tokenType = reflect.TypeOf(tokens.Token{})
+var bigIntType = reflect.TypeOf(&big.Int{})
+
+// Dump returns node and the nodes below it as an indented tree, one node per
+// line with its position and the values it holds. It is meant for debugging,
+// for example by the REPL's :ast command.
+func Dump(node Node) string {
+	var out bytes.Buffer
+	dumpValue(&out, reflect.ValueOf(node), "", 0)
+	return out.String()
+}
+
+// dumpValue writes v, which is a node, a slice of nodes or a struct grouping
+// nodes such as a HashLiteralPair, at the given depth. Nil nodes and empty
+// slices are left out.
+func dumpValue(out *bytes.Buffer, v reflect.Value, label string, depth int) {
+	var pos tokens.Position
+
+	for v.Kind() == reflect.Interface || v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return
+		}
+		if node, ok := v.Interface().(Node); ok {
+			pos = node.Pos()
+		}
+		v = v.Elem()
+	}
+
+	var indent string = strings.Repeat("  ", depth)
+
+	switch v.Kind() {
+	case reflect.Slice:
+		if v.Len() == 0 {
+			return
+		}
+
+		out.WriteString(indent + strings.TrimSuffix(label, " ") + "\n")
+		for i := 0; i < v.Len(); i++ {
+			dumpValue(out, v.Index(i), "", depth+1)
+		}
+
+	case reflect.Struct:
+		out.WriteString(indent + label + v.Type().Name())
+		if pos.IsValid() {
+			out.WriteString(" " + pos.String())
+		}
+
+		var children []int
+		for i := 0; i < v.NumField(); i++ {
+			var field reflect.StructField = v.Type().Field(i)
+			var value reflect.Value = v.Field(i)
+
+			if field.Type == tokenType {
+				continue
+			}
+
+			if field.Type == bigIntType {
+				if !value.IsNil() {
+					fmt.Fprintf(out, " %s=%s", field.Name, value.Interface())
+				}
+				continue
+			}
+
+			switch value.Kind() {
+			case reflect.String:
+				// Most nodes have no doc comment.
+				if field.Name != "Doc" || value.String() != "" {
+					fmt.Fprintf(out, " %s=%q", field.Name, value.String())
+				}
+			case reflect.Int64, reflect.Float64, reflect.Bool:
+				fmt.Fprintf(out, " %s=%v", field.Name, value.Interface())
+			default:
+				children = append(children, i)
+			}
+		}
+		out.WriteString("\n")
+
+		for _, i := range children {
+			dumpValue(out, v.Field(i), v.Type().Field(i).Name+": ", depth+1)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package code
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"mana/tokens"
+	"sort"
+)
+
+// Instructions is a flat sequence of encoded instructions.
+type Instructions []byte
+
+// String disassembles the instructions, one per line, prefixed with their
+// byte offset.
+func (ins Instructions) String() string {
+	var out bytes.Buffer
+
+	i := 0
+	for i < len(ins) {
+		def, err := Lookup(ins[i])
+		if err != nil {
+			fmt.Fprintf(&out, "ERROR: %s\n", err)
+			i++
+			continue
+		}
+
+		operands, read := ReadOperands(def, ins[i+1:])
+
+		fmt.Fprintf(&out, "%04d %s\n", i, ins.fmtInstruction(def, operands))
+
+		i += 1 + read
+	}
+
+	return out.String()
+}
+
+func (ins Instructions) fmtInstruction(def *Definition, operands []int) string {
+	operandCount := len(def.OperandWidths)
+
+	if len(operands) != operandCount {
+		return fmt.Sprintf("ERROR: operand len %d does not match defined %d\n", len(operands), operandCount)
+	}
+
+	switch operandCount {
+	case 0:
+		return def.Name
+	case 1:
+		return fmt.Sprintf("%s %d", def.Name, operands[0])
+	case 2:
+		return fmt.Sprintf("%s %d %d", def.Name, operands[0], operands[1])
+	}
+
+	return fmt.Sprintf("ERROR: unhandled operandCount for %s\n", def.Name)
+}
+
+// Opcode identifies an instruction.
+type Opcode byte
+
+const (
+	// OpConstant pushes the constant at the given index of the constant pool.
+	OpConstant Opcode = iota
+	// OpPop discards the top of the stack.
+	OpPop
+	// OpDupTwo pushes copies of the top two values of the stack, keeping
+	// their order.
+	OpDupTwo
+
+	OpAdd
+	OpSub
+	OpMul
+	OpDiv
+	OpMod
+	OpEqual
+	OpNotEqual
+	OpGreaterThan
+	OpLessThan
+	OpGreaterEqual
+	OpLessEqual
+
+	OpMinus
+	OpBang
+
+	OpTrue
+	OpFalse
+	OpNull
+	// OpNil pushes Go's nil. It marks a program whose last statement does
+	// not produce a value, such as a let statement.
+	OpNil
+
+	OpJumpNotTruthy
+	OpJump
+
+	// OpJumpIfFalsy, OpJumpIfTruthy and OpJumpIfNotNull implement &&, ||
+	// and ??. If the value on top of the stack decides the result, they
+	// jump and leave it there; otherwise they pop it.
+	OpJumpIfFalsy
+	OpJumpIfTruthy
+	OpJumpIfNotNull
+
+	// OpIterator replaces the value on top of the stack with an iterator
+	// over it. OpIterNext pushes the iterator's next value, or jumps to its
+	// operand once the iterator is exhausted.
+	OpIterator
+	OpIterNext
+
+	OpGetGlobal
+	OpSetGlobal
+	// OpSetConstGlobal is OpSetGlobal for a const statement. It marks the
+	// global as a constant, so that assigning to it is an error.
+	OpSetConstGlobal
+	OpGetLocal
+	OpSetLocal
+	OpGetFree
+
+	// OpAssignGlobal, OpAssignLocal and OpAssignFree store the top of the
+	// stack in a variable that has already been declared, leaving the value
+	// on the stack as the result of the assignment.
+	OpAssignGlobal
+	OpAssignLocal
+	OpAssignFree
+
+	OpArray
+	OpHash
+	OpIndex
+	// OpSetIndex pops a value, an index and an array or hash, stores the
+	// value at the index and pushes the value back.
+	OpSetIndex
+
+	OpCall
+	OpReturnValue
+	OpReturn
+	OpClosure
+)
+
+// Definition describes an opcode's name and the byte width of each operand.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[Opcode]*Definition{
+	OpConstant: {"OpConstant", []int{2}},
+	OpPop:      {"OpPop", []int{}},
+	OpDupTwo:   {"OpDupTwo", []int{}},
+
+	OpAdd:          {"OpAdd", []int{}},
+	OpSub:          {"OpSub", []int{}},
+	OpMul:          {"OpMul", []int{}},
+	OpDiv:          {"OpDiv", []int{}},
+	OpMod:          {"OpMod", []int{}},
+	OpEqual:        {"OpEqual", []int{}},
+	OpNotEqual:     {"OpNotEqual", []int{}},
+	OpGreaterThan:  {"OpGreaterThan", []int{}},
+	OpLessThan:     {"OpLessThan", []int{}},
+	OpGreaterEqual: {"OpGreaterEqual", []int{}},
+	OpLessEqual:    {"OpLessEqual", []int{}},
+
+	OpMinus: {"OpMinus", []int{}},
+	OpBang:  {"OpBang", []int{}},
+
+	OpTrue:  {"OpTrue", []int{}},
+	OpFalse: {"OpFalse", []int{}},
+	OpNull:  {"OpNull", []int{}},
+	OpNil:   {"OpNil", []int{}},
+
+	OpJumpNotTruthy: {"OpJumpNotTruthy", []int{2}},
+	OpJump:          {"OpJump", []int{2}},
+	OpJumpIfFalsy:   {"OpJumpIfFalsy", []int{2}},
+	OpJumpIfTruthy:  {"OpJumpIfTruthy", []int{2}},
+	OpJumpIfNotNull: {"OpJumpIfNotNull", []int{2}},
+	OpIterator:      {"OpIterator", []int{}},
+	OpIterNext:      {"OpIterNext", []int{2}},
+
+	OpGetGlobal:      {"OpGetGlobal", []int{2}},
+	OpSetGlobal:      {"OpSetGlobal", []int{2}},
+	OpSetConstGlobal: {"OpSetConstGlobal", []int{2}},
+	OpGetLocal:       {"OpGetLocal", []int{1}},
+	OpSetLocal:       {"OpSetLocal", []int{1}},
+	OpGetFree:        {"OpGetFree", []int{1}},
+
+	OpAssignGlobal: {"OpAssignGlobal", []int{2}},
+	OpAssignLocal:  {"OpAssignLocal", []int{1}},
+	OpAssignFree:   {"OpAssignFree", []int{1}},
+
+	OpArray:    {"OpArray", []int{2}},
+	OpHash:     {"OpHash", []int{2}},
+	OpIndex:    {"OpIndex", []int{}},
+	OpSetIndex: {"OpSetIndex", []int{}},
+
+	OpCall:        {"OpCall", []int{1}},
+	OpReturnValue: {"OpReturnValue", []int{}},
+	OpReturn:      {"OpReturn", []int{}},
+	OpClosure:     {"OpClosure", []int{2}},
+}
+
+// Lookup returns the definition of an opcode.
+func Lookup(op byte) (*Definition, error) {
+	def, ok := definitions[Opcode(op)]
+	if !ok {
+		return nil, fmt.Errorf("opcode %d undefined", op)
+	}
+
+	return def, nil
+}
+
+// Make encodes an instruction from its opcode and operands. Operands are
+// stored big-endian. Make returns an empty slice for an unknown opcode.
+func Make(op Opcode, operands ...int) []byte {
+	def, ok := definitions[op]
+	if !ok {
+		return []byte{}
+	}
+
+	instructionLen := 1
+	for _, w := range def.OperandWidths {
+		instructionLen += w
+	}
+
+	instruction := make([]byte, instructionLen)
+	instruction[0] = byte(op)
+
+	offset := 1
+	for i, o := range operands {
+		width := def.OperandWidths[i]
+		switch width {
+		case 2:
+			binary.BigEndian.PutUint16(instruction[offset:], uint16(o))
+		case 1:
+			instruction[offset] = byte(o)
+		}
+		offset += width
+	}
+
+	return instruction
+}
+
+// ReadOperands decodes the operands of an instruction and returns them along
+// with the number of bytes read.
+func ReadOperands(def *Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		}
+
+		offset += width
+	}
+
+	return operands, offset
+}
+
+// ReadUint16 decodes a two-byte operand.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a one-byte operand.
+func ReadUint8(ins Instructions) uint8 {
+	return uint8(ins[0])
+}
+
+// PositionEntry records that the instructions starting at Offset were
+// compiled from the source at Pos.
+type PositionEntry struct {
+	Offset int
+	Pos    tokens.Position
+}
+
+// PositionTable maps instruction offsets back to source positions. Entries are
+// sorted by offset, and each entry covers the instructions up to the next.
+type PositionTable []PositionEntry
+
+// Lookup returns the source position of the instruction at offset.
+func (t PositionTable) Lookup(offset int) tokens.Position {
+	i := sort.Search(len(t), func(i int) bool { return t[i].Offset > offset })
+	if i == 0 {
+		return tokens.Position{}
+	}
+
+	return t[i-1].Pos
+}
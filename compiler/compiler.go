@@ -0,0 +1,964 @@
+package compiler
+
+import (
+	"fmt"
+	"mana/ast"
+	"mana/code"
+	"mana/object"
+	"mana/tokens"
+	"math"
+	"strings"
+)
+
+// Compiler lowers an AST to bytecode for the vm package.
+type Compiler struct {
+	constants []object.Object
+
+	symbolTable *SymbolTable
+
+	scopes     []CompilationScope
+	scopeIndex int
+
+	// pos is the position of the innermost node being compiled. Emitted
+	// instructions are attributed to it, so runtime errors point at the same
+	// node the evaluator would blame.
+	pos tokens.Position
+
+	// returnJumps holds the jumps emitted for top-level return statements,
+	// to be patched to the end of the program.
+	returnJumps []int
+}
+
+// CompilationScope holds the instructions of the function being compiled.
+type CompilationScope struct {
+	instructions        code.Instructions
+	positions           code.PositionTable
+	lastInstruction     EmittedInstruction
+	previousInstruction EmittedInstruction
+
+	// loops holds the loops being compiled in this function, innermost last.
+	loops []*loopScope
+
+	// held counts the values that enclosing expressions have left on the
+	// stack at the current point, such as the left operand of an infix
+	// expression while its right operand runs.
+	held int
+}
+
+// loopScope collects the jumps emitted for break and continue statements,
+// to be patched once the loop's exit and continue targets are known.
+type loopScope struct {
+	breaks    []int
+	continues []int
+
+	// held is the number of held values when the loop starts. A break or
+	// continue pops any values held above it before it jumps.
+	held int
+}
+
+// EmittedInstruction remembers an opcode and where it was emitted.
+type EmittedInstruction struct {
+	Opcode   code.Opcode
+	Position int
+}
+
+// Bytecode is the output of the compiler.
+type Bytecode struct {
+	Instructions code.Instructions
+	Positions    code.PositionTable
+	Constants    []object.Object
+
+	// GlobalNames holds the name of each global slot. Names that are never
+	// defined by the program are looked up as builtins at runtime.
+	GlobalNames []string
+}
+
+// New returns a Compiler with an empty global scope.
+func New() *Compiler {
+	mainScope := CompilationScope{}
+
+	return &Compiler{
+		constants:   []object.Object{},
+		symbolTable: NewSymbolTable(),
+		scopes:      []CompilationScope{mainScope},
+		scopeIndex:  0,
+	}
+}
+
+// NewWithState returns a Compiler that continues from an existing global
+// symbol table and constant pool, as the REPL does between lines.
+func NewWithState(s *SymbolTable, constants []object.Object) *Compiler {
+	compiler := New()
+	compiler.symbolTable = s
+	compiler.constants = constants
+	return compiler
+}
+
+// Compile compiles node and everything below it.
+func (c *Compiler) Compile(node ast.Node) error {
+	outer := c.pos
+	if node != nil {
+		c.pos = node.Pos()
+	}
+	defer func() { c.pos = outer }()
+
+	switch node := node.(type) {
+	case *ast.Program:
+		return c.compileProgram(node)
+
+	case *ast.ExpressionStatement:
+		if err := c.Compile(node.Expression); err != nil {
+			return err
+		}
+		c.emit(code.OpPop)
+
+	case *ast.BlockStatement:
+		for _, s := range node.Statements {
+			if err := c.Compile(s); err != nil {
+				return err
+			}
+		}
+
+	case *ast.LetStatement:
+		return c.compileBinding(node.Name.Value, node.Value, false)
+
+	case *ast.ConstStatement:
+		return c.compileBinding(node.Name.Value, node.Value, true)
+
+	case *ast.FunctionStatement:
+		symbol := c.symbolTable.Define(node.Name.Value)
+		if err := c.compileFunction(node.Function, node.Name.Value); err != nil {
+			return err
+		}
+		return c.storeSymbol(symbol)
+
+	case *ast.ReturnStatement:
+		if err := c.Compile(node.ReturnValue); err != nil {
+			return err
+		}
+
+		if c.scopeIndex == 0 {
+			// A top-level return ends the program with its value.
+			c.emit(code.OpPop)
+			c.returnJumps = append(c.returnJumps, c.emit(code.OpJump, 9999))
+		} else {
+			c.emit(code.OpReturnValue)
+		}
+
+	case *ast.WhileStatement:
+		return c.compileWhileStatement(node)
+
+	case *ast.ForStatement:
+		return c.compileForStatement(node)
+
+	case *ast.ForInStatement:
+		return c.compileForInStatement(node)
+
+	case *ast.BreakStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("break outside of a loop")
+		}
+		c.popHeld(loop)
+		loop.breaks = append(loop.breaks, c.emit(code.OpJump, 9999))
+
+	case *ast.ContinueStatement:
+		loop := c.currentLoop()
+		if loop == nil {
+			return fmt.Errorf("continue outside of a loop")
+		}
+		c.popHeld(loop)
+		loop.continues = append(loop.continues, c.emit(code.OpJump, 9999))
+
+	case *ast.Identifier:
+		return c.loadSymbol(c.resolve(node.Value))
+
+	case *ast.IntegerLiteral:
+		var integer object.Object = &object.Integer{Value: node.Value}
+		if node.Big != nil {
+			integer = &object.BigInt{Value: node.Big}
+		}
+		c.emit(code.OpConstant, c.addConstant(integer))
+
+	case *ast.FloatLiteral:
+		float := &object.Float{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(float))
+
+	case *ast.StringLiteral:
+		str := &object.String{Value: node.Value}
+		c.emit(code.OpConstant, c.addConstant(str))
+
+	case *ast.Boolean:
+		if node.Value {
+			c.emit(code.OpTrue)
+		} else {
+			c.emit(code.OpFalse)
+		}
+
+	case *ast.PrefixExpression:
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+
+		switch node.Operator {
+		case "!":
+			c.emit(code.OpBang)
+		case "-":
+			c.emit(code.OpMinus)
+		default:
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+
+	case *ast.InfixExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+
+		if jump, ok := logicalOpcodes[node.Operator]; ok {
+			jumpPos := c.emit(jump, 9999)
+			if err := c.Compile(node.Right); err != nil {
+				return err
+			}
+			c.changeOperand(jumpPos, len(c.currentInstructions()))
+			return nil
+		}
+
+		c.hold(1)
+		if err := c.Compile(node.Right); err != nil {
+			return err
+		}
+		c.hold(-1)
+
+		op, ok := infixOpcodes[node.Operator]
+		if !ok {
+			return fmt.Errorf("unknown operator %s", node.Operator)
+		}
+		c.emit(op)
+
+	case *ast.IfExpression:
+		return c.compileIfExpression(node)
+
+	case *ast.FunctionLiteral:
+		return c.compileFunction(node, "")
+
+	case *ast.CallExpression:
+		if err := c.Compile(node.Function); err != nil {
+			return err
+		}
+
+		if len(node.Arguments) > 255 {
+			return fmt.Errorf("too many arguments in call: %d", len(node.Arguments))
+		}
+
+		c.hold(1)
+		for _, a := range node.Arguments {
+			if err := c.Compile(a); err != nil {
+				return err
+			}
+			c.hold(1)
+		}
+		c.hold(-1 - len(node.Arguments))
+
+		c.emit(code.OpCall, len(node.Arguments))
+
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			if err := c.Compile(el); err != nil {
+				return err
+			}
+			c.hold(1)
+		}
+		c.hold(-len(node.Elements))
+
+		c.emit(code.OpArray, len(node.Elements))
+
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			if err := c.Compile(pair.Key); err != nil {
+				return err
+			}
+			c.hold(1)
+			if err := c.Compile(pair.Value); err != nil {
+				return err
+			}
+			c.hold(1)
+		}
+		c.hold(-2 * len(node.Pairs))
+
+		c.emit(code.OpHash, len(node.Pairs)*2)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(node.Left); err != nil {
+			return err
+		}
+		c.hold(1)
+		if err := c.Compile(node.Index); err != nil {
+			return err
+		}
+		c.hold(-1)
+
+		c.emit(code.OpIndex)
+
+	case *ast.AssignExpression:
+		return c.compileAssignExpression(node)
+	}
+
+	return nil
+}
+
+// compileBinding compiles a let or const statement binding name to value.
+func (c *Compiler) compileBinding(name string, value ast.Expression, constant bool) error {
+	var symbol Symbol
+	function, isFunction := value.(*ast.FunctionLiteral)
+
+	// A function bound by let can refer to itself, so the name has to be in
+	// scope while its body is compiled.
+	if isFunction {
+		symbol = c.symbolTable.Define(name)
+		if err := c.compileFunction(function, name); err != nil {
+			return err
+		}
+	} else {
+		if err := c.Compile(value); err != nil {
+			return err
+		}
+		symbol = c.symbolTable.Define(name)
+	}
+
+	// Constants are checked when the program is parsed. Global ones are
+	// also tracked by the VM, which catches assignments the parser could
+	// not see, such as from a function defined before the constant.
+	if constant && symbol.Scope == GlobalScope {
+		if symbol.Index > 65535 {
+			return fmt.Errorf("too many global variables: %d", symbol.Index+1)
+		}
+		c.emit(code.OpSetConstGlobal, symbol.Index)
+		return nil
+	}
+
+	return c.storeSymbol(symbol)
+}
+
+// compileAssignExpression compiles an assignment, which leaves the assigned
+// value on the stack. A compound assignment loads the current value and
+// applies its operator before storing.
+func (c *Compiler) compileAssignExpression(node *ast.AssignExpression) error {
+	// The infix operator of a compound assignment, or "" for plain "=".
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		symbol := c.resolve(target.Value)
+		if operator != "" {
+			if err := c.Compile(target); err != nil {
+				return err
+			}
+			c.hold(1)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if operator != "" {
+			c.hold(-1)
+			c.emit(infixOpcodes[operator])
+		}
+		return c.assignSymbol(symbol)
+
+	case *ast.IndexExpression:
+		if err := c.Compile(target.Left); err != nil {
+			return err
+		}
+		c.hold(1)
+		if err := c.Compile(target.Index); err != nil {
+			return err
+		}
+		c.hold(1)
+		if operator != "" {
+			c.emit(code.OpDupTwo)
+			c.emit(code.OpIndex)
+			c.hold(1)
+		}
+		if err := c.Compile(node.Value); err != nil {
+			return err
+		}
+		if operator != "" {
+			c.hold(-1)
+			c.emit(infixOpcodes[operator])
+		}
+		c.hold(-2)
+		c.emit(code.OpSetIndex)
+
+	default:
+		return fmt.Errorf("cannot assign to %s", node.Target.String())
+	}
+
+	return nil
+}
+
+var infixOpcodes = map[string]code.Opcode{
+	"+":  code.OpAdd,
+	"-":  code.OpSub,
+	"*":  code.OpMul,
+	"/":  code.OpDiv,
+	"%":  code.OpMod,
+	"==": code.OpEqual,
+	"!=": code.OpNotEqual,
+	">":  code.OpGreaterThan,
+	"<":  code.OpLessThan,
+	">=": code.OpGreaterEqual,
+	"<=": code.OpLessEqual,
+}
+
+// logicalOpcodes maps the short-circuiting operators to the jump that skips
+// their right operand.
+var logicalOpcodes = map[string]code.Opcode{
+	"&&": code.OpJumpIfFalsy,
+	"||": code.OpJumpIfTruthy,
+	"??": code.OpJumpIfNotNull,
+}
+
+// Bytecode returns the compiled program.
+func (c *Compiler) Bytecode() *Bytecode {
+	return &Bytecode{
+		Instructions: c.currentInstructions(),
+		Positions:    c.scopes[c.scopeIndex].positions,
+		Constants:    c.constants,
+		GlobalNames:  c.globals().Names(),
+	}
+}
+
+// SymbolTable returns the global symbol table, to be passed to NewWithState.
+func (c *Compiler) SymbolTable() *SymbolTable {
+	return c.symbolTable
+}
+
+func (c *Compiler) compileProgram(program *ast.Program) error {
+	for _, s := range program.Statements {
+		if err := c.Compile(s); err != nil {
+			return err
+		}
+	}
+
+	// Like the evaluator, a program whose last statement produces no value
+	// has no result at all.
+	if n := len(program.Statements); n == 0 || !producesValue(program.Statements[n-1]) {
+		c.emit(code.OpNil)
+		c.emit(code.OpPop)
+	}
+
+	c.patchJumps(c.returnJumps, len(c.currentInstructions()))
+	c.returnJumps = nil
+
+	return c.checkOperandLimits()
+}
+
+// checkOperandLimits reports an error if the current scope has grown past
+// what two-byte operands can address: a jump cannot reach beyond 65535
+// bytes of bytecode, and OpConstant cannot index beyond 65536 constants.
+func (c *Compiler) checkOperandLimits() error {
+	if n := len(c.currentInstructions()); n > math.MaxUint16 {
+		return fmt.Errorf("too much code in one function: %d bytes of bytecode", n)
+	}
+	if n := len(c.constants); n > math.MaxUint16+1 {
+		return fmt.Errorf("too many constants: %d", n)
+	}
+	return nil
+}
+
+func (c *Compiler) compileIfExpression(node *ast.IfExpression) error {
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+
+	jumpNotTruthyPos := c.emit(code.OpJumpNotTruthy, 9999)
+
+	if err := c.compileBranch(node.Consequence); err != nil {
+		return err
+	}
+
+	jumpPos := c.emit(code.OpJump, 9999)
+	c.changeOperand(jumpNotTruthyPos, len(c.currentInstructions()))
+
+	if node.Alternative == nil {
+		c.emit(code.OpNull)
+	} else if err := c.compileBranch(node.Alternative); err != nil {
+		return err
+	}
+
+	c.changeOperand(jumpPos, len(c.currentInstructions()))
+
+	return nil
+}
+
+// compileBranch compiles one branch of an if expression so that it leaves
+// exactly one value on the stack.
+func (c *Compiler) compileBranch(block *ast.BlockStatement) error {
+	if err := c.Compile(block); err != nil {
+		return err
+	}
+
+	if producesValue(block) {
+		c.removeLastPop()
+	} else {
+		c.emit(code.OpNull)
+	}
+
+	return nil
+}
+
+func (c *Compiler) compileWhileStatement(node *ast.WhileStatement) error {
+	loopStart := len(c.currentInstructions())
+
+	if err := c.Compile(node.Condition); err != nil {
+		return err
+	}
+	exitJump := c.emit(code.OpJumpNotTruthy, 9999)
+
+	loop := c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+
+	c.emit(code.OpJump, loopStart)
+
+	loopEnd := len(c.currentInstructions())
+	c.changeOperand(exitJump, loopEnd)
+	c.patchJumps(loop.continues, loopStart)
+	c.patchJumps(loop.breaks, loopEnd)
+
+	return nil
+}
+
+func (c *Compiler) compileForStatement(node *ast.ForStatement) error {
+	if node.Init != nil {
+		if err := c.Compile(node.Init); err != nil {
+			return err
+		}
+	}
+
+	loopStart := len(c.currentInstructions())
+
+	exitJump := -1
+	if node.Condition != nil {
+		if err := c.Compile(node.Condition); err != nil {
+			return err
+		}
+		exitJump = c.emit(code.OpJumpNotTruthy, 9999)
+	}
+
+	loop := c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+
+	// continue jumps to the update clause, which follows the body.
+	updateStart := len(c.currentInstructions())
+	if node.Update != nil {
+		if err := c.Compile(node.Update); err != nil {
+			return err
+		}
+	}
+
+	c.emit(code.OpJump, loopStart)
+
+	loopEnd := len(c.currentInstructions())
+	if exitJump >= 0 {
+		c.changeOperand(exitJump, loopEnd)
+	}
+	c.patchJumps(loop.continues, updateStart)
+	c.patchJumps(loop.breaks, loopEnd)
+
+	return nil
+}
+
+func (c *Compiler) compileForInStatement(node *ast.ForInStatement) error {
+	if err := c.Compile(node.Iterable); err != nil {
+		return err
+	}
+	c.emit(code.OpIterator)
+	c.hold(1)
+
+	loopStart := len(c.currentInstructions())
+	nextJump := c.emit(code.OpIterNext, 9999)
+
+	if err := c.storeSymbol(c.symbolTable.Define(node.Variable.Value)); err != nil {
+		return err
+	}
+
+	loop := c.enterLoop()
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+	c.leaveLoop()
+
+	c.emit(code.OpJump, loopStart)
+
+	// Both the exhausted iterator and break end up here, with the iterator
+	// still on the stack.
+	loopEnd := len(c.currentInstructions())
+	c.changeOperand(nextJump, loopEnd)
+	c.patchJumps(loop.continues, loopStart)
+	c.patchJumps(loop.breaks, loopEnd)
+	c.emit(code.OpPop)
+	c.hold(-1)
+
+	return nil
+}
+
+func (c *Compiler) enterLoop() *loopScope {
+	scope := &c.scopes[c.scopeIndex]
+	loop := &loopScope{held: scope.held}
+	scope.loops = append(scope.loops, loop)
+	return loop
+}
+
+func (c *Compiler) leaveLoop() {
+	scope := &c.scopes[c.scopeIndex]
+	scope.loops = scope.loops[:len(scope.loops)-1]
+}
+
+func (c *Compiler) currentLoop() *loopScope {
+	loops := c.scopes[c.scopeIndex].loops
+	if len(loops) == 0 {
+		return nil
+	}
+	return loops[len(loops)-1]
+}
+
+// hold records that n more values are held on the stack, or that -n values
+// are no longer held.
+func (c *Compiler) hold(n int) {
+	c.scopes[c.scopeIndex].held += n
+}
+
+// popHeld pops the values held above the start of loop, which a break or
+// continue would otherwise leave on the stack.
+func (c *Compiler) popHeld(loop *loopScope) {
+	for i := c.scopes[c.scopeIndex].held; i > loop.held; i-- {
+		c.emit(code.OpPop)
+	}
+}
+
+func (c *Compiler) patchJumps(jumps []int, target int) {
+	for _, pos := range jumps {
+		c.changeOperand(pos, target)
+	}
+}
+
+func (c *Compiler) compileFunction(node *ast.FunctionLiteral, name string) error {
+	c.enterScope()
+
+	for _, p := range node.Parameters {
+		c.symbolTable.DefineParameter(p.Value)
+	}
+	declareLocals(c.symbolTable, node.Body)
+
+	if err := c.Compile(node.Body); err != nil {
+		return err
+	}
+
+	if producesValue(node.Body) {
+		c.replaceLastPopWithReturn()
+	} else {
+		c.emit(code.OpReturn)
+	}
+
+	freeSymbols := c.symbolTable.FreeSymbols
+	localFallbacks := c.symbolTable.LocalFallbacks
+	freeFallbacks := c.symbolTable.FreeFallbacks
+	numLocals := c.symbolTable.NumDefinitions()
+	localNames := c.symbolTable.Names()
+
+	if numLocals > 256 {
+		return fmt.Errorf("too many local variables in function: %d", numLocals)
+	}
+	if len(freeSymbols) > 256 {
+		return fmt.Errorf("too many free variables in function: %d", len(freeSymbols))
+	}
+	if err := c.checkOperandLimits(); err != nil {
+		return err
+	}
+
+	positions := c.scopes[c.scopeIndex].positions
+	instructions := c.leaveScope()
+
+	free := make([]object.FreeVariable, len(freeSymbols))
+	for i, s := range freeSymbols {
+		free[i] = object.FreeVariable{Name: s.Name, IsLocal: s.Scope == LocalScope, Index: s.Index}
+	}
+
+	compiledFn := &object.CompiledFunction{
+		Instructions:   instructions,
+		Positions:      positions,
+		NumLocals:      numLocals,
+		NumParameters:  len(node.Parameters),
+		Name:           name,
+		LocalNames:     localNames,
+		Free:           free,
+		LocalFallbacks: localFallbacks,
+		FreeFallbacks:  freeFallbacks,
+		Parameters:     node.Parameters,
+		Body:           node.Body,
+	}
+
+	c.emit(code.OpClosure, c.addConstant(compiledFn))
+
+	return nil
+}
+
+// declareLocals declares every name that node binds in the function being
+// compiled, so that closures defined before a binding can still refer to it.
+// Nested function literals are skipped; they declare their own locals.
+func declareLocals(s *SymbolTable, node ast.Node) {
+	switch node := node.(type) {
+	case *ast.BlockStatement:
+		for _, stmt := range node.Statements {
+			declareLocals(s, stmt)
+		}
+	case *ast.LetStatement:
+		s.Declare(node.Name.Value)
+		declareLocals(s, node.Value)
+	case *ast.ConstStatement:
+		s.Declare(node.Name.Value)
+		declareLocals(s, node.Value)
+	case *ast.FunctionStatement:
+		s.Declare(node.Name.Value)
+	case *ast.ExpressionStatement:
+		declareLocals(s, node.Expression)
+	case *ast.ReturnStatement:
+		declareLocals(s, node.ReturnValue)
+	case *ast.WhileStatement:
+		declareLocals(s, node.Condition)
+		declareLocals(s, node.Body)
+	case *ast.ForStatement:
+		declareLocals(s, node.Init)
+		declareLocals(s, node.Condition)
+		declareLocals(s, node.Update)
+		declareLocals(s, node.Body)
+	case *ast.ForInStatement:
+		s.Declare(node.Variable.Value)
+		declareLocals(s, node.Iterable)
+		declareLocals(s, node.Body)
+	case *ast.IfExpression:
+		declareLocals(s, node.Condition)
+		declareLocals(s, node.Consequence)
+		if node.Alternative != nil {
+			declareLocals(s, node.Alternative)
+		}
+	case *ast.PrefixExpression:
+		declareLocals(s, node.Right)
+	case *ast.InfixExpression:
+		declareLocals(s, node.Left)
+		declareLocals(s, node.Right)
+	case *ast.AssignExpression:
+		declareLocals(s, node.Target)
+		declareLocals(s, node.Value)
+	case *ast.CallExpression:
+		declareLocals(s, node.Function)
+		for _, arg := range node.Arguments {
+			declareLocals(s, arg)
+		}
+	case *ast.ArrayLiteral:
+		for _, el := range node.Elements {
+			declareLocals(s, el)
+		}
+	case *ast.IndexExpression:
+		declareLocals(s, node.Left)
+		declareLocals(s, node.Index)
+	case *ast.HashLiteral:
+		for _, pair := range node.Pairs {
+			declareLocals(s, pair.Key)
+			declareLocals(s, pair.Value)
+		}
+	}
+}
+
+// producesValue reports whether a statement leaves a value behind when it is
+// the last one of a program, block or function body.
+func producesValue(s ast.Statement) bool {
+	switch s := s.(type) {
+	case *ast.ExpressionStatement:
+		return true
+	case *ast.BlockStatement:
+		return len(s.Statements) > 0 && producesValue(s.Statements[len(s.Statements)-1])
+	default:
+		return false
+	}
+}
+
+// resolve looks up name, declaring it as a global if it is not bound
+// anywhere. Such a global is either defined later in the program or, if it
+// is still unset when read, looked up as a builtin.
+func (c *Compiler) resolve(name string) Symbol {
+	if symbol, ok := c.symbolTable.Resolve(name); ok {
+		return symbol
+	}
+
+	return c.globals().Define(name)
+}
+
+func (c *Compiler) globals() *SymbolTable {
+	s := c.symbolTable
+	for s.Outer != nil {
+		s = s.Outer
+	}
+	return s
+}
+
+func (c *Compiler) loadSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		if s.Index > 65535 {
+			return fmt.Errorf("too many global variables: %d", s.Index+1)
+		}
+		c.emit(code.OpGetGlobal, s.Index)
+	case LocalScope:
+		c.symbolTable.Fallback(s)
+		c.emit(code.OpGetLocal, s.Index)
+	case FreeScope:
+		c.symbolTable.Fallback(s)
+		c.emit(code.OpGetFree, s.Index)
+	}
+
+	return nil
+}
+
+func (c *Compiler) storeSymbol(s Symbol) error {
+	if s.Scope == GlobalScope {
+		if s.Index > 65535 {
+			return fmt.Errorf("too many global variables: %d", s.Index+1)
+		}
+		c.emit(code.OpSetGlobal, s.Index)
+	} else {
+		c.emit(code.OpSetLocal, s.Index)
+	}
+
+	return nil
+}
+
+func (c *Compiler) assignSymbol(s Symbol) error {
+	switch s.Scope {
+	case GlobalScope:
+		if s.Index > 65535 {
+			return fmt.Errorf("too many global variables: %d", s.Index+1)
+		}
+		c.emit(code.OpAssignGlobal, s.Index)
+	case LocalScope:
+		c.symbolTable.Fallback(s)
+		c.emit(code.OpAssignLocal, s.Index)
+	case FreeScope:
+		c.symbolTable.Fallback(s)
+		c.emit(code.OpAssignFree, s.Index)
+	}
+
+	return nil
+}
+
+func (c *Compiler) addConstant(obj object.Object) int {
+	c.constants = append(c.constants, obj)
+	return len(c.constants) - 1
+}
+
+func (c *Compiler) emit(op code.Opcode, operands ...int) int {
+	ins := code.Make(op, operands...)
+	pos := c.addInstruction(ins)
+
+	c.setLastInstruction(op, pos)
+
+	return pos
+}
+
+func (c *Compiler) addInstruction(ins []byte) int {
+	scope := &c.scopes[c.scopeIndex]
+	posNewInstruction := len(scope.instructions)
+
+	if n := len(scope.positions); n == 0 || scope.positions[n-1].Pos != c.pos {
+		scope.positions = append(scope.positions, code.PositionEntry{Offset: posNewInstruction, Pos: c.pos})
+	}
+
+	scope.instructions = append(scope.instructions, ins...)
+
+	return posNewInstruction
+}
+
+func (c *Compiler) setLastInstruction(op code.Opcode, pos int) {
+	previous := c.scopes[c.scopeIndex].lastInstruction
+	last := EmittedInstruction{Opcode: op, Position: pos}
+
+	c.scopes[c.scopeIndex].previousInstruction = previous
+	c.scopes[c.scopeIndex].lastInstruction = last
+}
+
+func (c *Compiler) currentInstructions() code.Instructions {
+	return c.scopes[c.scopeIndex].instructions
+}
+
+func (c *Compiler) lastInstructionIs(op code.Opcode) bool {
+	if len(c.currentInstructions()) == 0 {
+		return false
+	}
+
+	return c.scopes[c.scopeIndex].lastInstruction.Opcode == op
+}
+
+func (c *Compiler) removeLastPop() {
+	if !c.lastInstructionIs(code.OpPop) {
+		return
+	}
+
+	scope := &c.scopes[c.scopeIndex]
+	last := scope.lastInstruction
+
+	scope.instructions = scope.instructions[:last.Position]
+	for n := len(scope.positions); n > 0 && scope.positions[n-1].Offset >= last.Position; n-- {
+		scope.positions = scope.positions[:n-1]
+	}
+	scope.lastInstruction = scope.previousInstruction
+}
+
+func (c *Compiler) replaceLastPopWithReturn() {
+	if !c.lastInstructionIs(code.OpPop) {
+		c.emit(code.OpReturn)
+		return
+	}
+
+	lastPos := c.scopes[c.scopeIndex].lastInstruction.Position
+	c.replaceInstruction(lastPos, code.Make(code.OpReturnValue))
+
+	c.scopes[c.scopeIndex].lastInstruction.Opcode = code.OpReturnValue
+}
+
+func (c *Compiler) replaceInstruction(pos int, newInstruction []byte) {
+	ins := c.currentInstructions()
+
+	for i := 0; i < len(newInstruction); i++ {
+		ins[pos+i] = newInstruction[i]
+	}
+}
+
+func (c *Compiler) changeOperand(opPos int, operand int) {
+	op := code.Opcode(c.currentInstructions()[opPos])
+	newInstruction := code.Make(op, operand)
+
+	c.replaceInstruction(opPos, newInstruction)
+}
+
+func (c *Compiler) enterScope() {
+	c.scopes = append(c.scopes, CompilationScope{})
+	c.scopeIndex++
+
+	c.symbolTable = NewEnclosedSymbolTable(c.symbolTable)
+}
+
+func (c *Compiler) leaveScope() code.Instructions {
+	instructions := c.currentInstructions()
+
+	c.scopes = c.scopes[:len(c.scopes)-1]
+	c.scopeIndex--
+
+	c.symbolTable = c.symbolTable.Outer
+
+	return instructions
+}
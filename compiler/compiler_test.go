@@ -0,0 +1,686 @@
+package compiler
+
+import (
+	"fmt"
+	"mana/ast"
+	"mana/code"
+	"mana/lexer"
+	"mana/object"
+	"mana/parser"
+	"strings"
+	"testing"
+)
+
+type compilerTestCase struct {
+	input                string
+	expectedConstants    []interface{}
+	expectedInstructions []code.Instructions
+}
+
+func TestIntegerArithmetic(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "1 + 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 < 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpLessThan),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "-1",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpMinus),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConditionals(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "if (true) { 10 }; 3333;",
+			expectedConstants: []interface{}{10, 3333},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 10),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpJump, 11),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpPop),
+				// 0012
+				code.Make(code.OpConstant, 1),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "if (true) { let a = 1; }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 14),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpSetGlobal, 0),
+				// 0010
+				code.Make(code.OpNull),
+				// 0011
+				code.Make(code.OpJump, 15),
+				// 0014
+				code.Make(code.OpNull),
+				// 0015
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "true && false",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpIfFalsy, 5),
+				// 0004
+				code.Make(code.OpFalse),
+				// 0005
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "1 ?? 2",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpJumpIfNotNull, 9),
+				// 0006
+				code.Make(code.OpConstant, 1),
+				// 0009
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestLoops(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "while (true) { break; continue; }",
+			expectedConstants: []interface{}{},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 13),
+				// 0004
+				code.Make(code.OpJump, 13),
+				// 0007
+				code.Make(code.OpJump, 0),
+				// 0010
+				code.Make(code.OpJump, 0),
+				// 0013
+				code.Make(code.OpNil),
+				// 0014
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			// break pops the operands held by the enclosing expressions.
+			input:             "while (true) { 1 + [2, if (true) { break; }] }",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpTrue),
+				// 0001
+				code.Make(code.OpJumpNotTruthy, 32),
+				// 0004
+				code.Make(code.OpConstant, 0),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpTrue),
+				// 0011
+				code.Make(code.OpJumpNotTruthy, 23),
+				// 0014
+				code.Make(code.OpPop),
+				// 0015
+				code.Make(code.OpPop),
+				// 0016
+				code.Make(code.OpJump, 32),
+				// 0019
+				code.Make(code.OpNull),
+				// 0020
+				code.Make(code.OpJump, 24),
+				// 0023
+				code.Make(code.OpNull),
+				// 0024
+				code.Make(code.OpArray, 2),
+				// 0027
+				code.Make(code.OpAdd),
+				// 0028
+				code.Make(code.OpPop),
+				// 0029
+				code.Make(code.OpJump, 0),
+				// 0032
+				code.Make(code.OpNil),
+				// 0033
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "for (x in [1]) { x }",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpArray, 1),
+				// 0006
+				code.Make(code.OpIterator),
+				// 0007
+				code.Make(code.OpIterNext, 20),
+				// 0010
+				code.Make(code.OpSetGlobal, 0),
+				// 0013
+				code.Make(code.OpGetGlobal, 0),
+				// 0016
+				code.Make(code.OpPop),
+				// 0017
+				code.Make(code.OpJump, 7),
+				// 0020
+				code.Make(code.OpPop),
+				// 0021
+				code.Make(code.OpNil),
+				// 0022
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestGlobalLetStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let one = 1; let two = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 1),
+				code.Make(code.OpNil),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let one = 1; let one = 2; one",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "const one = 1; one",
+			expectedConstants: []interface{}{1},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetConstGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { const one = 1; one }",
+			expectedConstants: []interface{}{
+				1,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpSetLocal, 0),
+					code.Make(code.OpGetLocal, 0),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 1),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "let x = 1; x = 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let x = 1; x += 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpAdd),
+				code.Make(code.OpAssignGlobal, 0),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input:             "let xs = [1]; xs[0] *= 3;",
+			expectedConstants: []interface{}{1, 0, 3},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpConstant, 0),
+				code.Make(code.OpArray, 1),
+				code.Make(code.OpSetGlobal, 0),
+				code.Make(code.OpGetGlobal, 0),
+				code.Make(code.OpConstant, 1),
+				code.Make(code.OpDupTwo),
+				code.Make(code.OpIndex),
+				code.Make(code.OpConstant, 2),
+				code.Make(code.OpMul),
+				code.Make(code.OpSetIndex),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestTopLevelReturn(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input:             "return 1; 2;",
+			expectedConstants: []interface{}{1, 2},
+			expectedInstructions: []code.Instructions{
+				// 0000
+				code.Make(code.OpConstant, 0),
+				// 0003
+				code.Make(code.OpPop),
+				// 0004
+				code.Make(code.OpJump, 11),
+				// 0007
+				code.Make(code.OpConstant, 1),
+				// 0010
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestFunctions(t *testing.T) {
+	tests := []compilerTestCase{
+		{
+			input: "fn() { return 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { 5 + 10 }",
+			expectedConstants: []interface{}{
+				5,
+				10,
+				[]code.Instructions{
+					code.Make(code.OpConstant, 0),
+					code.Make(code.OpConstant, 1),
+					code.Make(code.OpAdd),
+					code.Make(code.OpReturnValue),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 2),
+				code.Make(code.OpPop),
+			},
+		},
+		{
+			input: "fn() { }",
+			expectedConstants: []interface{}{
+				[]code.Instructions{
+					code.Make(code.OpReturn),
+				},
+			},
+			expectedInstructions: []code.Instructions{
+				code.Make(code.OpClosure, 0),
+				code.Make(code.OpPop),
+			},
+		},
+	}
+
+	runCompilerTests(t, tests)
+}
+
+func TestClosures(t *testing.T) {
+	input := "fn(a) { fn(b) { a + b } }"
+
+	program := parse(input)
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	inner, ok := compiler.Bytecode().Constants[0].(*object.CompiledFunction)
+	if !ok {
+		t.Fatalf("constant 0 is not CompiledFunction. got=%T", compiler.Bytecode().Constants[0])
+	}
+
+	if len(inner.Free) != 1 {
+		t.Fatalf("inner function has wrong number of free variables. got=%d", len(inner.Free))
+	}
+
+	expected := object.FreeVariable{Name: "a", IsLocal: true, Index: 0}
+	if inner.Free[0] != expected {
+		t.Errorf("free variable wrong. want=%+v, got=%+v", expected, inner.Free[0])
+	}
+
+	err := testInstructions([]code.Instructions{
+		code.Make(code.OpGetFree, 0),
+		code.Make(code.OpGetLocal, 0),
+		code.Make(code.OpAdd),
+		code.Make(code.OpReturnValue),
+	}, inner.Instructions)
+	if err != "" {
+		t.Error(err)
+	}
+}
+
+func TestResolveFree(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	firstLocal := NewEnclosedSymbolTable(global)
+	firstLocal.Define("c")
+
+	secondLocal := NewEnclosedSymbolTable(firstLocal)
+	secondLocal.Define("e")
+
+	expected := []Symbol{
+		{Name: "a", Scope: GlobalScope, Index: 0},
+		{Name: "c", Scope: FreeScope, Index: 0},
+		{Name: "e", Scope: LocalScope, Index: 0},
+	}
+
+	for _, sym := range expected {
+		result, ok := secondLocal.Resolve(sym.Name)
+		if !ok {
+			t.Errorf("name %s not resolvable", sym.Name)
+			continue
+		}
+		if result != sym {
+			t.Errorf("expected %s to resolve to %+v, got=%+v", sym.Name, sym, result)
+		}
+	}
+
+	if _, ok := secondLocal.Resolve("x"); ok {
+		t.Errorf("name x resolved, but was never defined")
+	}
+
+	if len(secondLocal.FreeSymbols) != 1 || secondLocal.FreeSymbols[0] != (Symbol{Name: "c", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong free symbols. got=%+v", secondLocal.FreeSymbols)
+	}
+}
+
+func TestDeclare(t *testing.T) {
+	global := NewSymbolTable()
+	global.Define("a")
+
+	local := NewEnclosedSymbolTable(global)
+	local.Declare("a")
+
+	if sym, _ := local.Resolve("a"); sym != (Symbol{Name: "a", Scope: GlobalScope, Index: 0}) {
+		t.Errorf("declared name should resolve outward in its own scope, got=%+v", sym)
+	}
+
+	nested := NewEnclosedSymbolTable(local)
+	if sym, _ := nested.Resolve("a"); sym != (Symbol{Name: "a", Scope: FreeScope, Index: 0}) {
+		t.Errorf("declared name should be free in a nested scope, got=%+v", sym)
+	}
+	if nested.FreeSymbols[0] != (Symbol{Name: "a", Scope: LocalScope, Index: 0}) {
+		t.Errorf("wrong free symbol. got=%+v", nested.FreeSymbols[0])
+	}
+
+	if sym := local.Define("a"); sym != (Symbol{Name: "a", Scope: LocalScope, Index: 0}) {
+		t.Errorf("Define should use the declared slot, got=%+v", sym)
+	}
+	if n := local.NumDefinitions(); n != 1 {
+		t.Errorf("wrong number of definitions. want=1, got=%d", n)
+	}
+}
+
+func TestFallback(t *testing.T) {
+	global := NewSymbolTable()
+	outer := NewEnclosedSymbolTable(global)
+	outerX := outer.Define("x")
+	inner := NewEnclosedSymbolTable(outer)
+	n := inner.DefineParameter("n")
+	innerX := inner.Define("x")
+
+	if sym, ok := outer.Fallback(outerX); ok {
+		t.Errorf("a local of the outermost function should fall back to a global, got=%+v", sym)
+	}
+	if sym, ok := inner.Fallback(n); ok {
+		t.Errorf("a parameter should have no fallback, got=%+v", sym)
+	}
+
+	sym, ok := inner.Fallback(innerX)
+	if !ok || sym != (Symbol{Name: "x", Scope: FreeScope, Index: 0}) {
+		t.Fatalf("wrong fallback. got=%+v, %t", sym, ok)
+	}
+	if inner.FreeSymbols[0] != outerX || inner.LocalFallbacks[innerX.Index] != 0 {
+		t.Errorf("fallback not captured. free=%+v, fallbacks=%v", inner.FreeSymbols, inner.LocalFallbacks)
+	}
+	if _, ok := inner.Resolve("x"); !ok || inner.store["x"] != innerX {
+		t.Errorf("capturing a fallback should not rebind x")
+	}
+}
+
+func TestPositions(t *testing.T) {
+	program := parse("let a = 1;\na + true")
+
+	compiler := New()
+	if err := compiler.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	bytecode := compiler.Bytecode()
+
+	// OpAdd is at offset 10, after OpConstant, OpSetGlobal, OpGetGlobal, OpTrue.
+	if got := bytecode.Positions.Lookup(10).String(); got != "2:3" {
+		t.Errorf("OpAdd has wrong position. want=%q, got=%q", "2:3", got)
+	}
+}
+
+func TestOperandLimits(t *testing.T) {
+	function := "fn() { " + strings.Repeat("1; ", 16383) + "};"
+
+	// captures returns a function whose innermost closure uses n variables
+	// of the two functions around it.
+	captures := func(n int) string {
+		var outer, inner, uses []string
+		for i := 0; i < n; i++ {
+			name := fmt.Sprintf("v%d", i)
+			if i < 200 {
+				outer = append(outer, "let "+name+" = 0;")
+			} else {
+				inner = append(inner, "let "+name+" = 0;")
+			}
+			uses = append(uses, name)
+		}
+		return "fn() { " + strings.Join(outer, " ") + " fn() { " + strings.Join(inner, " ") +
+			" fn() { [" + strings.Join(uses, ", ") + "] } } }"
+	}
+
+	tests := []struct {
+		input       string
+		expectedErr string
+	}{
+		{"-true; " + strings.Repeat("true; ", 32766), ""},
+		{strings.Repeat("true; ", 32768), "too much code in one function: 65536 bytes of bytecode"},
+		{"fn() { " + strings.Repeat("true; ", 32768) + "}", "too much code in one function: 65536 bytes of bytecode"},
+		{"if (true) { " + strings.Repeat("true; ", 32768) + "}", "too much code in one function: 65544 bytes of bytecode"},
+		{strings.Repeat(function, 4), ""},
+		{strings.Repeat(function, 4) + "1", "too many constants: 65537"},
+		{captures(256), ""},
+		{captures(257), "too many free variables in function: 257"},
+	}
+
+	for _, tt := range tests {
+		compiler := New()
+		err := compiler.Compile(parse(tt.input))
+
+		if tt.expectedErr == "" {
+			if err != nil {
+				t.Errorf("unexpected compiler error: %s", err)
+			}
+			continue
+		}
+
+		if err == nil || err.Error() != tt.expectedErr {
+			t.Errorf("wrong compiler error. want=%q, got=%v", tt.expectedErr, err)
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func runCompilerTests(t *testing.T, tests []compilerTestCase) {
+	t.Helper()
+
+	for _, tt := range tests {
+		program := parse(tt.input)
+
+		compiler := New()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := compiler.Bytecode()
+
+		if err := testInstructions(tt.expectedInstructions, bytecode.Instructions); err != "" {
+			t.Errorf("%s: %s", tt.input, err)
+		}
+
+		testConstants(t, tt.input, tt.expectedConstants, bytecode.Constants)
+	}
+}
+
+func testInstructions(expected []code.Instructions, actual code.Instructions) string {
+	concatted := code.Instructions{}
+	for _, ins := range expected {
+		concatted = append(concatted, ins...)
+	}
+
+	if concatted.String() != actual.String() {
+		return "wrong instructions.\nwant=\n" + concatted.String() + "got=\n" + actual.String()
+	}
+
+	return ""
+}
+
+func testConstants(t *testing.T, input string, expected []interface{}, actual []object.Object) {
+	t.Helper()
+
+	if len(expected) != len(actual) {
+		t.Errorf("%s: wrong number of constants. want=%d, got=%d", input, len(expected), len(actual))
+		return
+	}
+
+	for i, constant := range expected {
+		switch constant := constant.(type) {
+		case int:
+			integer, ok := actual[i].(*object.Integer)
+			if !ok || integer.Value != int64(constant) {
+				t.Errorf("%s: constant %d wrong. want=%d, got=%s", input, i, constant, actual[i].Inspect())
+			}
+		case []code.Instructions:
+			fn, ok := actual[i].(*object.CompiledFunction)
+			if !ok {
+				t.Errorf("%s: constant %d is not CompiledFunction. got=%T", input, i, actual[i])
+				continue
+			}
+			if err := testInstructions(constant, fn.Instructions); err != "" {
+				t.Errorf("%s: constant %d: %s", input, i, err)
+			}
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package compiler
+
+type SymbolScope string
+
+const (
+	GlobalScope SymbolScope = "GLOBAL"
+	LocalScope  SymbolScope = "LOCAL"
+	FreeScope   SymbolScope = "FREE"
+)
+
+// Symbol is a name resolved to a storage slot.
+type Symbol struct {
+	Name  string
+	Scope SymbolScope
+	Index int
+}
+
+// SymbolTable maps names to slots for one function scope, or for the global
+// scope if it has no Outer table.
+type SymbolTable struct {
+	Outer *SymbolTable
+
+	// FreeSymbols holds, for each free variable of this scope, the symbol
+	// it refers to in the enclosing scope.
+	FreeSymbols []Symbol
+
+	// LocalFallbacks and FreeFallbacks map a local slot or free variable
+	// to the free variable that Fallback captured for it.
+	LocalFallbacks map[int]int
+	FreeFallbacks  map[int]int
+
+	store         map[string]Symbol
+	declared      map[string]Symbol
+	names         []string
+	numParameters int
+}
+
+// NewSymbolTable returns a new global SymbolTable.
+func NewSymbolTable() *SymbolTable {
+	return &SymbolTable{
+		LocalFallbacks: make(map[int]int),
+		FreeFallbacks:  make(map[int]int),
+		store:          make(map[string]Symbol),
+		declared:       make(map[string]Symbol),
+	}
+}
+
+// NewEnclosedSymbolTable returns a new function scope nested in outer.
+func NewEnclosedSymbolTable(outer *SymbolTable) *SymbolTable {
+	s := NewSymbolTable()
+	s.Outer = outer
+	return s
+}
+
+// Define binds name in this scope. A name already defined in this scope keeps
+// its slot, so redefining it overwrites the old value, just like a second let
+// in the same Environment does in the evaluator.
+func (s *SymbolTable) Define(name string) Symbol {
+	if symbol, ok := s.store[name]; ok && symbol.Scope == s.scope() {
+		return symbol
+	}
+
+	if symbol, ok := s.declared[name]; ok {
+		delete(s.declared, name)
+		s.store[name] = symbol
+		return symbol
+	}
+
+	return s.define(name)
+}
+
+// Declare reserves a slot for a name the scope will Define later. Until
+// then, reads in this scope still resolve the name in the enclosing scopes,
+// as the evaluator does before the let has run, but functions nested in
+// this scope already resolve it to the reserved slot. If they run before the
+// slot is set, they read the Fallback of the slot instead.
+func (s *SymbolTable) Declare(name string) {
+	if symbol, ok := s.store[name]; ok && symbol.Scope == s.scope() {
+		return
+	}
+	if _, ok := s.declared[name]; ok {
+		return
+	}
+
+	s.declared[name] = Symbol{Name: name, Index: len(s.names), Scope: s.scope()}
+	s.names = append(s.names, name)
+}
+
+// DefineParameter binds a function parameter to a fresh slot, even if an
+// earlier parameter has the same name; the later parameter wins.
+func (s *SymbolTable) DefineParameter(name string) Symbol {
+	s.numParameters++
+	return s.define(name)
+}
+
+func (s *SymbolTable) define(name string) Symbol {
+	symbol := Symbol{Name: name, Index: len(s.names), Scope: s.scope()}
+	s.store[name] = symbol
+	s.names = append(s.names, name)
+	return symbol
+}
+
+// Resolve looks name up in this scope and then in the enclosing ones. A name
+// found in an enclosing function scope becomes a free variable of this one.
+func (s *SymbolTable) Resolve(name string) (Symbol, bool) {
+	symbol, ok := s.store[name]
+	if !ok && s.Outer != nil {
+		symbol, ok = s.Outer.resolveFromInner(name)
+		if !ok || symbol.Scope == GlobalScope {
+			return symbol, ok
+		}
+
+		return s.defineFree(symbol), true
+	}
+
+	return symbol, ok
+}
+
+// resolveFromInner resolves name for a function nested in this scope, which
+// also sees the names this scope has only declared so far.
+func (s *SymbolTable) resolveFromInner(name string) (Symbol, bool) {
+	if symbol, ok := s.declared[name]; ok {
+		return symbol, true
+	}
+	return s.Resolve(name)
+}
+
+// Fallback returns the symbol that reading or assigning symbol, a local or
+// free variable of this scope, falls back to while its slot is unset. The
+// evaluator then goes on to look the name up in the enclosing scopes, so the
+// fallback is the slot the enclosing functions have for the name, captured
+// as a free variable of this scope. Fallback reports false if the name falls
+// back to a global or builtin instead, or if the slot is a parameter, which
+// is always set.
+func (s *SymbolTable) Fallback(symbol Symbol) (Symbol, bool) {
+	var fallbacks map[int]int
+	var outer Symbol
+	var ok bool
+
+	switch {
+	case symbol.Scope == LocalScope && symbol.Index >= s.numParameters:
+		fallbacks = s.LocalFallbacks
+		if index, ok := fallbacks[symbol.Index]; ok {
+			return Symbol{Name: symbol.Name, Scope: FreeScope, Index: index}, true
+		}
+		outer, ok = s.Outer.resolveFromInner(symbol.Name)
+
+	case symbol.Scope == FreeScope:
+		fallbacks = s.FreeFallbacks
+		if index, ok := fallbacks[symbol.Index]; ok {
+			return Symbol{Name: symbol.Name, Scope: FreeScope, Index: index}, true
+		}
+		outer, ok = s.Outer.Fallback(s.FreeSymbols[symbol.Index])
+
+	default:
+		return Symbol{}, false
+	}
+
+	if !ok || outer.Scope == GlobalScope {
+		return Symbol{}, false
+	}
+
+	fallback := s.capture(outer)
+	fallbacks[symbol.Index] = fallback.Index
+	return fallback, true
+}
+
+// Names returns the name of every slot defined in this scope, by index.
+func (s *SymbolTable) Names() []string {
+	return s.names
+}
+
+// NumDefinitions returns the number of slots defined in this scope.
+func (s *SymbolTable) NumDefinitions() int {
+	return len(s.names)
+}
+
+func (s *SymbolTable) defineFree(original Symbol) Symbol {
+	s.FreeSymbols = append(s.FreeSymbols, original)
+
+	symbol := Symbol{Name: original.Name, Index: len(s.FreeSymbols) - 1, Scope: FreeScope}
+	s.store[original.Name] = symbol
+
+	return symbol
+}
+
+// capture returns a free variable of this scope that refers to original, a
+// symbol of the enclosing scope, adding one if there is none yet. Unlike
+// defineFree it does not bind the name in this scope.
+func (s *SymbolTable) capture(original Symbol) Symbol {
+	for i, free := range s.FreeSymbols {
+		if free == original {
+			return Symbol{Name: original.Name, Scope: FreeScope, Index: i}
+		}
+	}
+
+	s.FreeSymbols = append(s.FreeSymbols, original)
+	return Symbol{Name: original.Name, Scope: FreeScope, Index: len(s.FreeSymbols) - 1}
+}
+
+func (s *SymbolTable) scope() SymbolScope {
+	if s.Outer == nil {
+		return GlobalScope
+	}
+	return LocalScope
+}
@@ -0,0 +1,144 @@
+package evaluator
+
+import (
+	"fmt"
+	"mana/object"
+	"unicode/utf8"
+)
+
+// builtins holds the functions that are visible to every program without
+// being bound in its environment. Bindings in the environment shadow them.
+var builtins = map[string]*object.Builtin{
+	"len":   {Fn: builtinLen},
+	"puts":  {Fn: builtinPuts},
+	"first": {Fn: builtinFirst},
+	"last":  {Fn: builtinLast},
+	"rest":  {Fn: builtinRest},
+	"push":  {Fn: builtinPush},
+	"type":  {Fn: builtinType},
+}
+
+// RegisterBuiltin exposes a Go function to mana programs under the given name,
+// replacing any builtin already registered under it. It is meant to be called
+// while the host application sets up, before any program is evaluated.
+func RegisterBuiltin(name string, fn object.BuiltinFunction) {
+	builtins[name] = &object.Builtin{Fn: fn}
+}
+
+// len returns the number of characters in a string, elements in an array or
+// pairs in a hash.
+func builtinLen(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	switch arg := args[0].(type) {
+	case *object.String:
+		return &object.Integer{Value: int64(utf8.RuneCountInString(arg.Value))}
+	case *object.Array:
+		return &object.Integer{Value: int64(len(arg.Elements))}
+	case *object.Hash:
+		return &object.Integer{Value: int64(len(arg.Pairs))}
+	default:
+		return newError("argument to `len` not supported, got %s", args[0].Type())
+	}
+}
+
+// puts prints each argument on its own line.
+func builtinPuts(args ...object.Object) object.Object {
+	for _, arg := range args {
+		fmt.Println(arg.Inspect())
+	}
+
+	return NULL
+}
+
+// first returns the first element of an array, or null if it is empty.
+func builtinFirst(args ...object.Object) object.Object {
+	array, err := arrayArgument("first", args)
+	if err != nil {
+		return err
+	}
+
+	if len(array.Elements) > 0 {
+		return array.Elements[0]
+	}
+
+	return NULL
+}
+
+// last returns the last element of an array, or null if it is empty.
+func builtinLast(args ...object.Object) object.Object {
+	array, err := arrayArgument("last", args)
+	if err != nil {
+		return err
+	}
+
+	length := len(array.Elements)
+	if length > 0 {
+		return array.Elements[length-1]
+	}
+
+	return NULL
+}
+
+// rest returns a new array holding every element but the first, or null if
+// the array is empty.
+func builtinRest(args ...object.Object) object.Object {
+	array, err := arrayArgument("rest", args)
+	if err != nil {
+		return err
+	}
+
+	length := len(array.Elements)
+	if length > 0 {
+		newElements := make([]object.Object, length-1)
+		copy(newElements, array.Elements[1:length])
+		return &object.Array{Elements: newElements}
+	}
+
+	return NULL
+}
+
+// push returns a new array with the second argument appended to the first.
+// The original array is left untouched.
+func builtinPush(args ...object.Object) object.Object {
+	if len(args) != 2 {
+		return newError("wrong number of arguments: want=2, got=%d", len(args))
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return newError("argument to `push` must be ARRAY, got %s", args[0].Type())
+	}
+
+	length := len(array.Elements)
+	newElements := make([]object.Object, length+1)
+	copy(newElements, array.Elements)
+	newElements[length] = args[1]
+
+	return &object.Array{Elements: newElements}
+}
+
+// type returns the name of its argument's type as a string.
+func builtinType(args ...object.Object) object.Object {
+	if len(args) != 1 {
+		return newError("wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	return &object.String{Value: string(args[0].Type())}
+}
+
+// arrayArgument checks that a builtin was called with exactly one array.
+func arrayArgument(name string, args []object.Object) (*object.Array, *object.Error) {
+	if len(args) != 1 {
+		return nil, newError("wrong number of arguments: want=1, got=%d", len(args))
+	}
+
+	array, ok := args[0].(*object.Array)
+	if !ok {
+		return nil, newError("argument to `%s` must be ARRAY, got %s", name, args[0].Type())
+	}
+
+	return array, nil
+}
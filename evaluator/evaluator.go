@@ -4,16 +4,55 @@ import (
 	"fmt"
 	"mana/ast"
 	"mana/object"
+	"mana/tokens"
+	"math"
+	"math/big"
+	"strings"
 )
 
 var (
 	NULL  = &object.Null{}
 	TRUE  = &object.Boolean{Value: true}
 	FALSE = &object.Boolean{Value: false}
+
+	BREAK    = &object.Break{}
+	CONTINUE = &object.Continue{}
+)
+
+// MaxCallDepth is the number of function calls that can be active at once.
+// A call beyond it fails with a stack overflow error.
+const MaxCallDepth = 1<<16 - 1
+
+// OverflowMode selects what integer arithmetic does when its result does not
+// fit in an int64.
+type OverflowMode int
+
+const (
+	// PromoteOnOverflow makes the result a BigInt.
+	PromoteOnOverflow OverflowMode = iota
+	// ErrorOnOverflow makes the operation fail with an integer overflow error.
+	ErrorOnOverflow
 )
 
-// Eval evaluates the given ast.Node and returns an object.Object.
+// Overflow is the OverflowMode of both Eval and the operations the VM shares
+// with it. It applies to +, -, *, / and unary - on Integers; operations on a
+// BigInt always give an exact result.
+var Overflow OverflowMode = PromoteOnOverflow
+
+// Eval evaluates the given ast.Node and returns an object.Object. Errors that
+// do not carry a position yet are stamped with the position of the innermost
+// node that produced them.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+
+	if err, ok := result.(*object.Error); ok && !err.Pos.IsValid() && node != nil {
+		err.Pos = node.Pos()
+	}
+
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	switch node := node.(type) {
 	// Statements
 	case *ast.Program:
@@ -27,35 +66,63 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 
 	case *ast.LetStatement:
 		val := Eval(node.Value, env)
-		if isError(val) {
+		if isAbrupt(val) {
+			return val
+		}
+		nameFunction(node.Value, val, node.Name.Value)
+		return declare(env, node.Name.Value, val, false)
+
+	case *ast.ConstStatement:
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
 			return val
 		}
-		env.Set(node.Name.Value, val)
+		nameFunction(node.Value, val, node.Name.Value)
+		return declare(env, node.Name.Value, val, true)
+
+	case *ast.FunctionStatement:
+		function := &object.Function{Name: node.Name.Value, Parameters: node.Function.Parameters, Body: node.Function.Body, Env: env}
+		return declare(env, node.Name.Value, function, false)
 
 	case *ast.Identifier:
 		return evalIdentifier(node, env)
 
 	// Expressions
 	case *ast.IntegerLiteral:
+		if node.Big != nil {
+			return &object.BigInt{Value: node.Big}
+		}
 		return &object.Integer{Value: node.Value}
 
+	case *ast.FloatLiteral:
+		return &object.Float{Value: node.Value}
+
+	case *ast.StringLiteral:
+		return &object.String{Value: node.Value}
+
 	case *ast.Boolean:
 		return nativeBoolToBooleanObject(node.Value)
 
 	case *ast.PrefixExpression:
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalPrefixExpression(node.Operator, right)
 
 	case *ast.InfixExpression:
 		left := Eval(node.Left, env)
-		if isError(left) {
+		if isAbrupt(left) {
 			return left
 		}
+		if isLogicalOperator(node.Operator) {
+			if decided, ok := shortCircuit(node.Operator, left); ok {
+				return decided
+			}
+			return Eval(node.Right, env)
+		}
 		right := Eval(node.Right, env)
-		if isError(right) {
+		if isAbrupt(right) {
 			return right
 		}
 		return evalInfixExpression(node.Operator, left, right)
@@ -66,27 +133,68 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	case *ast.CallExpression:
 		function := Eval(node.Function, env)
 
-		if isError(function) {
+		if isAbrupt(function) {
 			return function
 		}
 
 		args := evalExpressions(node.Arguments, env)
-		if len(args) == 1 && isError(args[0]) {
+		if len(args) == 1 && isAbrupt(args[0]) {
 			return args[0]
 		}
 
+		return applyFunction(function, args, node.Pos(), env.Depth())
+
 	case *ast.FunctionLiteral:
 		params := node.Parameters
 		body := node.Body
 
 		return &object.Function{Parameters: params, Body: body, Env: env}
 
+	case *ast.ArrayLiteral:
+		elements := evalExpressions(node.Elements, env)
+		if len(elements) == 1 && isAbrupt(elements[0]) {
+			return elements[0]
+		}
+		return &object.Array{Elements: elements}
+
+	case *ast.HashLiteral:
+		return evalHashLiteral(node, env)
+
+	case *ast.IndexExpression:
+		left := Eval(node.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(node.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+		return evalIndexExpression(left, index)
+
+	case *ast.AssignExpression:
+		return evalAssignExpression(node, env)
+
 	case *ast.ReturnStatement:
 		val := Eval(node.ReturnValue, env)
-		if isError(val) {
+		if isAbrupt(val) {
 			return val
 		}
 		return &object.ReturnValue{Value: val}
+
+	case *ast.WhileStatement:
+		return evalWhileStatement(node, env)
+
+	case *ast.ForStatement:
+		return evalForStatement(node, env)
+
+	case *ast.ForInStatement:
+		return evalForInStatement(node, env)
+
+	case *ast.BreakStatement:
+		return BREAK
+
+	case *ast.ContinueStatement:
+		return CONTINUE
 	}
 
 	return nil
@@ -117,7 +225,8 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 
 		if result != nil {
 			rt := result.Type()
-			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ {
+			if rt == object.RETURN_VALUE_OBJ || rt == object.ERROR_OBJ ||
+				rt == object.BREAK_OBJ || rt == object.CONTINUE_OBJ {
 				return result
 			}
 		}
@@ -126,12 +235,135 @@ func evalBlockStatement(block *ast.BlockStatement, env *object.Environment) obje
 	return result
 }
 
+// evalLoopBody runs one iteration of a loop body. It reports whether the loop
+// should go on, and if not, the result that ends it: nil after a break, or the
+// return value or error that is propagated out of the loop.
+func evalLoopBody(body *ast.BlockStatement, env *object.Environment) (object.Object, bool) {
+	result := Eval(body, env)
+
+	if result != nil {
+		switch result.Type() {
+		case object.BREAK_OBJ:
+			return nil, false
+		case object.RETURN_VALUE_OBJ, object.ERROR_OBJ:
+			return result, false
+		}
+	}
+
+	return nil, true
+}
+
+// evalWhileStatement runs a while loop. Loops do not produce a value.
+func evalWhileStatement(loop *ast.WhileStatement, env *object.Environment) object.Object {
+	for {
+		condition := Eval(loop.Condition, env)
+		if isAbrupt(condition) {
+			return condition
+		}
+		if !isTruthy(condition) {
+			return nil
+		}
+
+		if result, ok := evalLoopBody(loop.Body, env); !ok {
+			return result
+		}
+	}
+}
+
+// evalForStatement runs a C-style for loop. The update clause also runs after
+// a continue.
+func evalForStatement(loop *ast.ForStatement, env *object.Environment) object.Object {
+	if loop.Init != nil {
+		if init := Eval(loop.Init, env); isAbrupt(init) {
+			return init
+		}
+	}
+
+	for {
+		if loop.Condition != nil {
+			condition := Eval(loop.Condition, env)
+			if isAbrupt(condition) {
+				return condition
+			}
+			if !isTruthy(condition) {
+				return nil
+			}
+		}
+
+		if result, ok := evalLoopBody(loop.Body, env); !ok {
+			return result
+		}
+
+		if loop.Update != nil {
+			if update := Eval(loop.Update, env); isAbrupt(update) {
+				return update
+			}
+		}
+	}
+}
+
+// evalForInStatement runs a for-in loop, binding the loop variable to each
+// value of the iterable in turn.
+func evalForInStatement(loop *ast.ForInStatement, env *object.Environment) object.Object {
+	iterable := Eval(loop.Iterable, env)
+	if isAbrupt(iterable) {
+		return iterable
+	}
+
+	values, err := iterationValues(iterable)
+	if err != nil {
+		return err
+	}
+
+	for _, value := range values {
+		if err := declare(env, loop.Variable.Value, value, false); err != nil {
+			return err
+		}
+
+		if result, ok := evalLoopBody(loop.Body, env); !ok {
+			return result
+		}
+	}
+
+	return nil
+}
+
+// iterationValues returns the values a for-in loop visits: the elements of an
+// array, the keys of a hash in insertion order, or the characters of a string
+// as one-character strings. The values are taken before the loop starts, so
+// changing the iterable in the loop body does not affect the iteration.
+func iterationValues(iterable object.Object) ([]object.Object, *object.Error) {
+	switch iterable := iterable.(type) {
+	case *object.Array:
+		values := make([]object.Object, len(iterable.Elements))
+		copy(values, iterable.Elements)
+		return values, nil
+
+	case *object.Hash:
+		values := make([]object.Object, len(iterable.Keys))
+		for i, key := range iterable.Keys {
+			values[i] = iterable.Pairs[key].Key
+		}
+		return values, nil
+
+	case *object.String:
+		values := []object.Object{}
+		for _, r := range iterable.Value {
+			values = append(values, &object.String{Value: string(r)})
+		}
+		return values, nil
+
+	default:
+		return nil, newError("cannot iterate over %s", iterable.Type())
+	}
+}
+
 func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Object {
 	var result []object.Object
 
 	for _, e := range exps {
 		evaluated := Eval(e, env)
-		if isError(evaluated) {
+		if isAbrupt(evaluated) {
 			return []object.Object{evaluated}
 		}
 
@@ -141,6 +373,93 @@ func evalExpressions(exps []ast.Expression, env *object.Environment) []object.Ob
 	return result
 }
 
+// applyFunction calls fn with args. pos is the position of the call, which is
+// recorded in the Frames of an error raised inside fn, and depth is the
+// number of calls already active.
+func applyFunction(fn object.Object, args []object.Object, pos tokens.Position, depth int) object.Object {
+	switch function := fn.(type) {
+	case *object.Function:
+		return applyUserFunction(function, args, pos, depth)
+	case *object.Builtin:
+		return valueOrNull(function.Fn(args...))
+	default:
+		return newError("not a function: %s", fn.Type())
+	}
+}
+
+func applyUserFunction(function *object.Function, args []object.Object, pos tokens.Position, depth int) object.Object {
+	if len(args) != len(function.Parameters) {
+		return newError("wrong number of arguments: want=%d, got=%d", len(function.Parameters), len(args))
+	}
+
+	// Unbounded recursion would otherwise exhaust the Go stack, which
+	// cannot be recovered from.
+	if depth >= MaxCallDepth {
+		return newError("stack overflow")
+	}
+
+	extendedEnv := extendFunctionEnv(function, args, depth+1)
+	evaluated := Eval(function.Body, extendedEnv)
+
+	if err, ok := evaluated.(*object.Error); ok {
+		err.Frames = append(err.Frames, callFrame(function, args, pos))
+		return err
+	}
+
+	return valueOrNull(unwrapReturnValue(evaluated))
+}
+
+// callFrame describes a call of function with args at pos for the Frames of
+// an error. It summarizes the arguments the function was called with, even if
+// the body has since assigned other values to its parameters.
+func callFrame(function *object.Function, args []object.Object, pos tokens.Position) object.Frame {
+	var name string = function.Name
+	if name == "" {
+		name = "<anonymous>"
+	}
+
+	return object.Frame{Function: name, Pos: pos, Args: object.ArgsSummary(args)}
+}
+
+// nameFunction names the function a let or const statement binds, if value
+// is a function literal, so that it shows up by name in stack traces.
+func nameFunction(value ast.Expression, val object.Object, name string) {
+	if _, ok := value.(*ast.FunctionLiteral); !ok {
+		return
+	}
+	if function, ok := val.(*object.Function); ok {
+		function.Name = name
+	}
+}
+
+func extendFunctionEnv(fn *object.Function, args []object.Object, depth int) *object.Environment {
+	env := object.NewCallEnvironment(fn.Env, depth)
+
+	for paramIdx, param := range fn.Parameters {
+		env.Set(param.Value, args[paramIdx])
+	}
+
+	return env
+}
+
+// valueOrNull turns the missing value of a block that ends in a statement,
+// such as a let, into NULL where the block is used as an expression.
+func valueOrNull(obj object.Object) object.Object {
+	if obj == nil {
+		return NULL
+	}
+
+	return obj
+}
+
+func unwrapReturnValue(obj object.Object) object.Object {
+	if returnValue, ok := obj.(*object.ReturnValue); ok {
+		return returnValue.Value
+	}
+
+	return obj
+}
+
 func nativeBoolToBooleanObject(input bool) *object.Boolean {
 	if input {
 		return TRUE
@@ -163,6 +482,12 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	switch {
 	case left.Type() == object.INTEGER_OBJ && right.Type() == object.INTEGER_OBJ:
 		return evalIntegerInfixExpression(operator, left, right)
+	case isInteger(left) && isInteger(right):
+		return evalBigIntInfixExpression(operator, left, right)
+	case isNumber(left) && isNumber(right):
+		return evalFloatInfixExpression(operator, left, right)
+	case left.Type() == object.STRING_OBJ && right.Type() == object.STRING_OBJ:
+		return evalStringInfixExpression(operator, left, right)
 	case operator == "==":
 		return nativeBoolToBooleanObject(left == right)
 	case operator == "!=":
@@ -174,6 +499,33 @@ func evalInfixExpression(operator string, left, right object.Object) object.Obje
 	}
 }
 
+// isLogicalOperator reports whether operator is one of the short-circuiting
+// operators &&, || and ??, whose right operand is only evaluated if the left
+// one does not decide the result.
+func isLogicalOperator(operator string) bool {
+	return operator == "&&" || operator == "||" || operator == "??"
+}
+
+// shortCircuit decides a logical operator from its left operand alone. It
+// returns the left operand and true if that is the result, or false if the
+// result is the right operand:
+//
+//	a && b   is a if a is falsy, otherwise b
+//	a || b   is a if a is truthy, otherwise b
+//	a ?? b   is a unless a is null, otherwise b
+func shortCircuit(operator string, left object.Object) (object.Object, bool) {
+	switch operator {
+	case "&&":
+		return left, !isTruthy(left)
+	case "||":
+		return left, isTruthy(left)
+	case "??":
+		return left, left != NULL
+	default:
+		return nil, false
+	}
+}
+
 func evalBangOperatorExpression(right object.Object) object.Object {
 	switch right {
 	case TRUE:
@@ -188,34 +540,214 @@ func evalBangOperatorExpression(right object.Object) object.Object {
 }
 
 func evalMinusPrefixOperatorExpression(right object.Object) object.Object {
-	if right.Type() != object.INTEGER_OBJ {
+	switch right := right.(type) {
+	case *object.Integer:
+		if right.Value == math.MinInt64 {
+			if Overflow == ErrorOnOverflow {
+				return newError("integer overflow: -(%d)", right.Value)
+			}
+			return object.IntegerFromBig(new(big.Int).Neg(big.NewInt(right.Value)))
+		}
+		return &object.Integer{Value: -right.Value}
+	case *object.BigInt:
+		return object.IntegerFromBig(new(big.Int).Neg(right.Value))
+	case *object.Float:
+		return &object.Float{Value: -right.Value}
+	default:
 		return newError("unknown operator: -%s", right.Type())
 	}
-
-	value := right.(*object.Integer).Value
-	return &object.Integer{Value: -value}
 }
 
+// evalIntegerInfixExpression applies operator to two integers. Division
+// truncates toward zero and the remainder takes the sign of the dividend, so
+// that a == (a / b) * b + a % b holds for any non-zero b. A result that does
+// not fit in an int64 is handled according to Overflow.
 func evalIntegerInfixExpression(operator string, left, right object.Object) object.Object {
 	leftValue := left.(*object.Integer).Value
 	rightValue := right.(*object.Integer).Value
 
 	switch operator {
 	case "+":
-		return &object.Integer{Value: leftValue + rightValue}
+		sum := leftValue + rightValue
+		if (leftValue^sum)&(rightValue^sum) < 0 {
+			return integerOverflow(operator, left, right)
+		}
+		return &object.Integer{Value: sum}
 	case "-":
-		return &object.Integer{Value: leftValue - rightValue}
+		difference := leftValue - rightValue
+		if (leftValue^rightValue)&(leftValue^difference) < 0 {
+			return integerOverflow(operator, left, right)
+		}
+		return &object.Integer{Value: difference}
 	case "*":
-		return &object.Integer{Value: leftValue * rightValue}
+		product := leftValue * rightValue
+		if leftValue != 0 && (product/leftValue != rightValue || (leftValue == -1 && rightValue == math.MinInt64)) {
+			return integerOverflow(operator, left, right)
+		}
+		return &object.Integer{Value: product}
 	case "/":
 		if rightValue == 0 {
-			return NULL
+			return newError("division by zero: %d / %d", leftValue, rightValue)
+		}
+		if leftValue == math.MinInt64 && rightValue == -1 {
+			return integerOverflow(operator, left, right)
 		}
 		return &object.Integer{Value: leftValue / rightValue}
+	case "%":
+		if rightValue == 0 {
+			return newError("division by zero: %d %% %d", leftValue, rightValue)
+		}
+		return &object.Integer{Value: leftValue % rightValue}
+	case "<":
+		return nativeBoolToBooleanObject(leftValue < rightValue)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// integerOverflow handles an operation on two Integers whose result does not
+// fit in an int64: it is either computed exactly as a BigInt or reported as
+// an error, depending on Overflow.
+func integerOverflow(operator string, left, right object.Object) object.Object {
+	if Overflow == ErrorOnOverflow {
+		return newError("integer overflow: %s %s %s", left.Inspect(), operator, right.Inspect())
+	}
+	return evalBigIntInfixExpression(operator, left, right)
+}
+
+// evalBigIntInfixExpression applies operator to two integers of which at
+// least one is a BigInt, with the same semantics as
+// evalIntegerInfixExpression. Results that fit in an int64 are Integers.
+func evalBigIntInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := toBig(left)
+	rightValue := toBig(right)
+
+	switch operator {
+	case "+":
+		return object.IntegerFromBig(new(big.Int).Add(leftValue, rightValue))
+	case "-":
+		return object.IntegerFromBig(new(big.Int).Sub(leftValue, rightValue))
+	case "*":
+		return object.IntegerFromBig(new(big.Int).Mul(leftValue, rightValue))
+	case "/":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero: %s / %s", leftValue, rightValue)
+		}
+		return object.IntegerFromBig(new(big.Int).Quo(leftValue, rightValue))
+	case "%":
+		if rightValue.Sign() == 0 {
+			return newError("division by zero: %s %% %s", leftValue, rightValue)
+		}
+		return object.IntegerFromBig(new(big.Int).Rem(leftValue, rightValue))
+	case "<":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) < 0)
+	case ">":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) > 0)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) <= 0)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) >= 0)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) == 0)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue.Cmp(rightValue) != 0)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// evalFloatInfixExpression applies operator to two numbers of which at least
+// one is a float; an integer operand is promoted to a float first. Arithmetic
+// follows IEEE 754, so dividing by zero gives an infinity or NaN, and NaN is
+// not equal to anything, itself included. Like the integer remainder, the
+// float remainder takes the sign of the dividend.
+func evalFloatInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := toFloat(left)
+	rightValue := toFloat(right)
+
+	switch operator {
+	case "+":
+		return &object.Float{Value: leftValue + rightValue}
+	case "-":
+		return &object.Float{Value: leftValue - rightValue}
+	case "*":
+		return &object.Float{Value: leftValue * rightValue}
+	case "/":
+		return &object.Float{Value: leftValue / rightValue}
+	case "%":
+		return &object.Float{Value: math.Mod(leftValue, rightValue)}
 	case "<":
 		return nativeBoolToBooleanObject(leftValue < rightValue)
 	case ">":
 		return nativeBoolToBooleanObject(leftValue > rightValue)
+	case "<=":
+		return nativeBoolToBooleanObject(leftValue <= rightValue)
+	case ">=":
+		return nativeBoolToBooleanObject(leftValue >= rightValue)
+	case "==":
+		return nativeBoolToBooleanObject(leftValue == rightValue)
+	case "!=":
+		return nativeBoolToBooleanObject(leftValue != rightValue)
+	default:
+		return newError("unknown operator: %s %s %s", left.Type(), operator, right.Type())
+	}
+}
+
+// isNumber reports whether obj is an integer or a float.
+func isNumber(obj object.Object) bool {
+	return isInteger(obj) || obj.Type() == object.FLOAT_OBJ
+}
+
+// isInteger reports whether obj is an Integer or a BigInt.
+func isInteger(obj object.Object) bool {
+	return obj.Type() == object.INTEGER_OBJ || obj.Type() == object.BIGINT_OBJ
+}
+
+// toBig converts an Integer or BigInt to a big.Int. The BigInt's own value is
+// returned, so it must not be modified.
+func toBig(obj object.Object) *big.Int {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return big.NewInt(obj.Value)
+	case *object.BigInt:
+		return obj.Value
+	default:
+		return new(big.Int)
+	}
+}
+
+// toFloat converts an integer or float to a float64.
+func toFloat(obj object.Object) float64 {
+	switch obj := obj.(type) {
+	case *object.Integer:
+		return float64(obj.Value)
+	case *object.BigInt:
+		value, _ := new(big.Float).SetInt(obj.Value).Float64()
+		return value
+	case *object.Float:
+		return obj.Value
+	default:
+		return math.NaN()
+	}
+}
+
+func evalStringInfixExpression(operator string, left, right object.Object) object.Object {
+	leftValue := left.(*object.String).Value
+	rightValue := right.(*object.String).Value
+
+	switch operator {
+	case "+":
+		return &object.String{Value: leftValue + rightValue}
 	case "==":
 		return nativeBoolToBooleanObject(leftValue == rightValue)
 	case "!=":
@@ -227,24 +759,253 @@ func evalIntegerInfixExpression(operator string, left, right object.Object) obje
 
 func evalIfExpression(ie *ast.IfExpression, env *object.Environment) object.Object {
 	condition := Eval(ie.Condition, env)
-	if isError(condition) {
+	if isAbrupt(condition) {
 		return condition
 	}
 	if isTruthy(condition) {
-		return Eval(ie.Consequence, env)
+		return valueOrNull(Eval(ie.Consequence, env))
 	} else if ie.Alternative != nil {
-		return Eval(ie.Alternative, env)
+		return valueOrNull(Eval(ie.Alternative, env))
 	} else {
 		return NULL
 	}
 }
 
-func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
-	val, ok := env.Get(node.Value)
+func evalIndexExpression(left, index object.Object) object.Object {
+	switch {
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.INTEGER_OBJ:
+		return evalArrayIndexExpression(left, index)
+	case left.Type() == object.ARRAY_OBJ && index.Type() == object.BIGINT_OBJ:
+		return bigIndexOutOfRange(left.(*object.Array), index)
+	case left.Type() == object.ARRAY_OBJ:
+		return newError("array index must be INTEGER, got %s", index.Type())
+	case left.Type() == object.HASH_OBJ:
+		return evalHashIndexExpression(left, index)
+	default:
+		return newError("index operator not supported: %s", left.Type())
+	}
+}
+
+// evalArrayIndexExpression indexes into an array. Negative indices count back
+// from the end of the array, Python-style, so arr[-1] is the last element.
+// Indices that fall outside the array after that adjustment are an error.
+func evalArrayIndexExpression(array, index object.Object) object.Object {
+	arrayObject := array.(*object.Array)
+	idx := index.(*object.Integer).Value
+	length := int64(len(arrayObject.Elements))
+
+	if idx < 0 {
+		idx += length
+	}
+
+	if idx < 0 || idx >= length {
+		return newError("index out of range: %d (length %d)", index.(*object.Integer).Value, length)
+	}
+
+	return arrayObject.Elements[idx]
+}
+
+// bigIndexOutOfRange reports a BigInt index into array, which is always out
+// of range.
+func bigIndexOutOfRange(array *object.Array, index object.Object) *object.Error {
+	return newError("index out of range: %s (length %d)", index.Inspect(), len(array.Elements))
+}
+
+func evalHashIndexExpression(hash, index object.Object) object.Object {
+	hashObject := hash.(*object.Hash)
+
+	key, ok := index.(object.Hashable)
+	if !ok {
+		return newError("unusable as hash key: %s", index.Type())
+	}
+
+	pair, ok := hashObject.Pairs[key.HashKey()]
 	if !ok {
-		return newError("identifier not found: " + node.Value)
+		return NULL
+	}
+
+	return pair.Value
+}
+
+func evalHashLiteral(node *ast.HashLiteral, env *object.Environment) object.Object {
+	pairs := make([]object.HashPair, 0, len(node.Pairs))
+
+	for _, pair := range node.Pairs {
+		key := Eval(pair.Key, env)
+		if isAbrupt(key) {
+			return key
+		}
+
+		value := Eval(pair.Value, env)
+		if isAbrupt(value) {
+			return value
+		}
+
+		pairs = append(pairs, object.HashPair{Key: key, Value: value})
+	}
+
+	return buildHash(pairs)
+}
+
+// buildHash builds a hash from evaluated pairs. Keys are only checked once
+// every pair has been evaluated, the same order the bytecode VM uses.
+func buildHash(pairs []object.HashPair) object.Object {
+	hash := object.NewHash()
+
+	for _, pair := range pairs {
+		hashKey, ok := pair.Key.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", pair.Key.Type())
+		}
+
+		hash.Set(hashKey.HashKey(), pair)
+	}
+
+	return hash
+}
+
+// declare binds name to val in env, as a constant if constant is set. It
+// returns an error if name is already a constant of env, and nil otherwise,
+// since declarations do not produce a value.
+func declare(env *object.Environment, name string, val object.Object, constant bool) object.Object {
+	if env.IsConstant(name) {
+		return newError("cannot redeclare constant: %s", name)
+	}
+
+	if constant {
+		env.SetConst(name, val)
+	} else {
+		env.Set(name, val)
 	}
-	return val
+
+	return nil
+}
+
+// evalAssignExpression assigns to a variable or to an element of an array or
+// hash and returns the assigned value. A compound assignment such as x += 1
+// reads the current value first and combines it with the right-hand side.
+func evalAssignExpression(node *ast.AssignExpression, env *object.Environment) object.Object {
+	// The infix operator of a compound assignment, or "" for plain "=".
+	operator := strings.TrimSuffix(node.Operator, "=")
+
+	switch target := node.Target.(type) {
+	case *ast.Identifier:
+		var current object.Object
+		if operator != "" {
+			current = Eval(target, env)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if operator != "" {
+			val = evalInfixExpression(operator, current, val)
+			if isError(val) {
+				return val
+			}
+		}
+
+		scope, ok := env.Resolve(target.Value)
+		if !ok {
+			return newError("assignment to undeclared variable: %s", target.Value)
+		}
+		if scope.IsConstant(target.Value) {
+			return newError("cannot assign to constant: %s", target.Value)
+		}
+		scope.Set(target.Value, val)
+		return val
+
+	case *ast.IndexExpression:
+		left := Eval(target.Left, env)
+		if isAbrupt(left) {
+			return left
+		}
+		index := Eval(target.Index, env)
+		if isAbrupt(index) {
+			return index
+		}
+
+		var current object.Object
+		if operator != "" {
+			current = evalIndexExpression(left, index)
+			if isError(current) {
+				return current
+			}
+		}
+
+		val := Eval(node.Value, env)
+		if isAbrupt(val) {
+			return val
+		}
+		if operator != "" {
+			val = evalInfixExpression(operator, current, val)
+			if isError(val) {
+				return val
+			}
+		}
+
+		return evalIndexAssignment(left, index, val)
+
+	default:
+		return newError("cannot assign to %s", node.Target.String())
+	}
+}
+
+// evalIndexAssignment stores val at left[index] and returns val. Array indices
+// follow the same rules as reading an element; hashes gain the key if it is
+// not present yet.
+func evalIndexAssignment(left, index, val object.Object) object.Object {
+	switch left := left.(type) {
+	case *object.Array:
+		if index.Type() == object.BIGINT_OBJ {
+			return bigIndexOutOfRange(left, index)
+		}
+
+		i, ok := index.(*object.Integer)
+		if !ok {
+			return newError("array index must be INTEGER, got %s", index.Type())
+		}
+
+		idx := i.Value
+		length := int64(len(left.Elements))
+		if idx < 0 {
+			idx += length
+		}
+		if idx < 0 || idx >= length {
+			return newError("index out of range: %d (length %d)", i.Value, length)
+		}
+
+		left.Elements[idx] = val
+		return val
+
+	case *object.Hash:
+		key, ok := index.(object.Hashable)
+		if !ok {
+			return newError("unusable as hash key: %s", index.Type())
+		}
+
+		left.Set(key.HashKey(), object.HashPair{Key: index, Value: val})
+		return val
+
+	default:
+		return newError("index assignment not supported: %s", left.Type())
+	}
+}
+
+func evalIdentifier(node *ast.Identifier, env *object.Environment) object.Object {
+	if val, ok := env.Get(node.Value); ok {
+		return val
+	}
+
+	if builtin, ok := builtins[node.Value]; ok {
+		return builtin
+	}
+
+	return newError("identifier not found: " + node.Value)
 }
 
 func isTruthy(obj object.Object) bool {
@@ -270,3 +1031,16 @@ func isError(obj object.Object) bool {
 	}
 	return false
 }
+
+// isAbrupt reports whether obj ends the evaluation of the expression that
+// produced it early: an error, or a return, break or continue that has to
+// reach its enclosing function or loop instead of being used as a value.
+func isAbrupt(obj object.Object) bool {
+	if obj != nil {
+		switch obj.Type() {
+		case object.ERROR_OBJ, object.RETURN_VALUE_OBJ, object.BREAK_OBJ, object.CONTINUE_OBJ:
+			return true
+		}
+	}
+	return false
+}
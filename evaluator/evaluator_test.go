@@ -1,10 +1,16 @@
-package evaluator
+package evaluator_test
 
 import (
+	"fmt"
+	"mana/ast"
+	"mana/compiler"
+	"mana/evaluator"
 	"mana/lexer"
 	"mana/object"
 	"mana/parser"
-
+	"mana/vm"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -28,14 +34,246 @@ func TestEvalIntegerExpression(t *testing.T) {
 		{"3 * 3 * 3 + 10", 37},
 		{"3 * (3 * 3) + 10", 37},
 		{"(5 + 10 * 2 + 15 / 3) * 2 + -10", 50},
+		{"7 % 3", 1},
+		{"-7 % 3", -1},
+		{"7 % -3", 1},
+		{"-7 % -3", -1},
+		{"-7 / 2", -3},
+		{"(-7 / 2) * 2 + -7 % 2", -7},
+		{"2 + 10 % 4 * 3", 8},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testIntegerObject(t, evaluated, tt.expected)
 	}
 }
 
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0o17 + 0b1010", 25},
+		{"1_000_000 / 1_000", 1000},
+		{"-0x10", -16},
+		{"-9223372036854775808", -9223372036854775808},
+		{"99999999999999999999 - 99999999999999999990", 9},
+		{"010 + 0_10", 20},
+		{"09 * 2", 18},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestBigIntegers(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"99999999999999999999", "99999999999999999999"},
+		{"-99999999999999999999", "-99999999999999999999"},
+		{"99999999999999999999 + 1", "100000000000000000000"},
+		{"1 - 99999999999999999999", "-99999999999999999998"},
+		{"99999999999999999999 * 99999999999999999999", "9999999999999999999800000000000000000001"},
+		{"99999999999999999999 / 7", "14285714285714285714"},
+		{"-99999999999999999999 / 7", "-14285714285714285714"},
+		{"99999999999999999999 * 2 / 2", "99999999999999999999"},
+		{"let x = 0x1_0000_0000_0000_0000; x", "18446744073709551616"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("%s: object is not BigInt. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if integer.Inspect() != tt.expected {
+			t.Errorf("%s: wrong value. got=%s, want=%s", tt.input, integer.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestBigIntegerOperations(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"99999999999999999999 % 7", 1},
+		{"-99999999999999999999 % 7", -1},
+		{"99999999999999999999 > 9223372036854775807", true},
+		{"-99999999999999999999 < -9223372036854775807", true},
+		{"99999999999999999999 == 99999999999999999999", true},
+		{"99999999999999999999 != 99999999999999999998", true},
+		{"99999999999999999999 == 1", false},
+		{"99999999999999999999 < 1e21", true},
+		{`let h = {99999999999999999999: "big"}; h[99999999999999999999]`, "big"},
+		{`type(99999999999999999999)`, "BIGINT"},
+		{`type(99999999999999999999 - 99999999999999999998)`, "INTEGER"},
+		{"99999999999999999999 / 0", "division by zero: 99999999999999999999 / 0"},
+		{"[1, 2][99999999999999999999]", "index out of range: 99999999999999999999 (length 2)"},
+		{"99999999999999999999 + true", "type mismatch: BIGINT + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case bool:
+			testBooleanObject(t, evaluated, expected)
+		case string:
+			var got string
+			switch obj := evaluated.(type) {
+			case *object.String:
+				got = obj.Value
+			case *object.Error:
+				got = obj.Message
+			}
+			if got != expected {
+				t.Errorf("%s: wrong result. want=%q, got=%s", tt.input, expected, describe(evaluated))
+			}
+		}
+	}
+}
+
+func TestIntegerOverflowPromotes(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "9223372036854775808"},
+		{"-9223372036854775807 - 2", "-9223372036854775809"},
+		{"9223372036854775807 * 2", "18446744073709551614"},
+		{"-1 * -9223372036854775808", "9223372036854775808"},
+		{"-9223372036854775808 * -1", "9223372036854775808"},
+		{"-(-9223372036854775808)", "9223372036854775808"},
+		{"-9223372036854775808 / -1", "9223372036854775808"},
+		{"let x = 9223372036854775807; x += 1; x", "9223372036854775808"},
+		{"let f = 1; for (let i = 1; i <= 25; i += 1) { f *= i; } f", "15511210043330985984000000"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := evaluated.(*object.BigInt)
+		if !ok {
+			t.Errorf("%s: object is not BigInt. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if integer.Inspect() != tt.expected {
+			t.Errorf("%s: wrong value. got=%s, want=%s", tt.input, integer.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestIntegerOverflowBoundaries(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"9223372036854775806 + 1", 9223372036854775807},
+		{"-9223372036854775807 - 1", -9223372036854775808},
+		{"4611686018427387904 * -2", -9223372036854775808},
+		{"-9223372036854775808 % -1", 0},
+		{"9223372036854775807 + 1 - 1", 9223372036854775807},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestIntegerOverflowErrors(t *testing.T) {
+	evaluator.Overflow = evaluator.ErrorOnOverflow
+	defer func() { evaluator.Overflow = evaluator.PromoteOnOverflow }()
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775807 + 1", "1:21: integer overflow: 9223372036854775807 + 1"},
+		{"-9223372036854775807 - 2", "1:22: integer overflow: -9223372036854775807 - 2"},
+		{"9223372036854775807 * 2", "1:21: integer overflow: 9223372036854775807 * 2"},
+		{"let min = -9223372036854775807 - 1;\n-min", "2:1: integer overflow: -(-9223372036854775808)"},
+		{"let x = 9223372036854775807;\nx += 1", "2:3: integer overflow: 9223372036854775807 + 1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if errObj.Error() != tt.expected {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Error())
+		}
+	}
+
+	// Operations on a BigInt are exact in either mode.
+	testIntegerObject(t, testEval(t, "99999999999999999999 - 99999999999999999998"), 1)
+}
+
+func TestEvalFloatExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"3.14", "3.14"},
+		{"-2.5", "-2.5"},
+		{"1.5 + 1.5", "3.0"},
+		{"1 + 0.5", "1.5"},
+		{"0.5 * 4", "2.0"},
+		{"7 / 2.0", "3.5"},
+		{"10 - 0.25", "9.75"},
+		{"1e3 * 2", "2000.0"},
+		{"0.1 + 0.2", "0.30000000000000004"},
+		{"1.0 / 0", "Inf"},
+		{"-1.0 / 0", "-Inf"},
+		{"0.0 / 0.0", "NaN"},
+		{"7.5 % 2", "1.5"},
+		{"-7.5 % 2", "-1.5"},
+		{"1.0 % 0", "NaN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		float, ok := evaluated.(*object.Float)
+		if !ok {
+			t.Errorf("%s: object is not Float. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+		if float.Inspect() != tt.expected {
+			t.Errorf("%s: wrong value. got=%s, want=%s", tt.input, float.Inspect(), tt.expected)
+		}
+	}
+}
+
+func TestFloatComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1.5 < 2", true},
+		{"2 > 1.5", true},
+		{"1 == 1.0", true},
+		{"1.0 != 1", false},
+		{"0.1 + 0.2 == 0.3", false},
+		{"let nan = 0.0 / 0.0; nan == nan", false},
+		{"let nan = 0.0 / 0.0; nan != nan", true},
+		{"1.0 / 0 > 1e308", true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
 func TestEvalBooleanExpression(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -63,11 +301,66 @@ func TestEvalBooleanExpression(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
 
+func TestComparisonOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"1 <= 2", true},
+		{"2 <= 2", true},
+		{"3 <= 2", false},
+		{"1 >= 2", false},
+		{"2 >= 2", true},
+		{"2.5 >= 2", true},
+		{"2 <= 1.5", false},
+		{"let nan = 0.0 / 0.0; nan <= nan", false},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestLogicalOperators(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"true && false", "false"},
+		{"true && true", "true"},
+		{"false || true", "true"},
+		{"false || false", "false"},
+		{"1 && 2", "2"},
+		{"false && 2", "false"},
+		{"1 || 2", "1"},
+		{`false || "fallback"`, "fallback"},
+		{"let n = if (false) { 1 }; n && 2", "null"},
+		{"let n = if (false) { 1 }; n ?? 5", "5"},
+		{"false ?? 5", "false"},
+		{"0 ?? 5", "0"},
+		{"1 < 2 && 2 < 3", "true"},
+		{"1 > 2 || 3 >= 3", "true"},
+		{"let n = if (false) { 1 }; n ?? n ?? 7", "7"},
+		// The right operand is not evaluated when the left one decides.
+		{"false && undefinedName", "false"},
+		{"true || 1 / 0", "true"},
+		{`"set" ?? missing()`, "set"},
+		{"let f = fn(x) { x > 0 && x < 10 }; [f(5), f(-1), f(50)]", "[true, false, false]"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated == nil || evaluated.Inspect() != tt.expected {
+			t.Errorf("%s: wrong result. want=%s, got=%+v", tt.input, tt.expected, evaluated)
+		}
+	}
+}
+
 func TestBangOperator(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -82,7 +375,7 @@ func TestBangOperator(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 		testBooleanObject(t, evaluated, tt.expected)
 	}
 }
@@ -102,7 +395,7 @@ func TestIfElseExpressions(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaulated := testEval(tt.input)
+		evaulated := testEval(t, tt.input)
 		integer, ok := tt.expected.(int)
 		if ok {
 			testIntegerObject(t, evaulated, int64(integer))
@@ -132,7 +425,7 @@ func TestReturnStatements(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		evaulated := testEval(tt.input)
+		evaulated := testEval(t, tt.input)
 		testIntegerObject(t, evaulated, tt.expected)
 	}
 }
@@ -181,10 +474,46 @@ func TestErrorhandling(t *testing.T) {
 			"foobar",
 			"identifier not found: foobar",
 		},
+		{
+			`"Hello" - "World"`,
+			"unknown operator: STRING - STRING",
+		},
+		{
+			`"Hello" + 5`,
+			"type mismatch: STRING + INTEGER",
+		},
+		{
+			`{"name": "Mana"}[fn(x) { x }];`,
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`{fn(x) { x }: "Mana"};`,
+			"unusable as hash key: FUNCTION",
+		},
+		{
+			`{[1]: 2}`,
+			"unusable as hash key: ARRAY",
+		},
+		{
+			"10 / 0",
+			"division by zero: 10 / 0",
+		},
+		{
+			"true && undefinedName",
+			"identifier not found: undefinedName",
+		},
+		{
+			`"a" <= "b"`,
+			"unknown operator: STRING <= STRING",
+		},
+		{
+			"let x = 0; 7 % x + 1",
+			"division by zero: 7 % 0",
+		},
 	}
 
 	for _, tt := range tests {
-		evaluated := testEval(tt.input)
+		evaluated := testEval(t, tt.input)
 
 		errObj, ok := evaluated.(*object.Error)
 		if !ok {
@@ -198,6 +527,124 @@ func TestErrorhandling(t *testing.T) {
 	}
 }
 
+func TestStackOverflow(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fn r(n) { r(n + 1) }\nr(0)", "1:12: stack overflow"},
+		{"let f = fn() { 1 + f() }; f()", "1:21: stack overflow"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T", tt.input, evaluated)
+			continue
+		}
+		if errObj.Error() != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, errObj.Error())
+		}
+		if len(errObj.Frames) != evaluator.MaxCallDepth {
+			t.Errorf("%q: wrong number of frames. want=%d, got=%d", tt.input, evaluator.MaxCallDepth, len(errObj.Frames))
+		}
+	}
+
+	// A recursion that stays within the limit still runs.
+	testIntegerObject(t, testEval(t, "fn count(n) { if (n == 0) { 0 } else { 1 + count(n - 1) } }\ncount(10000)"), 10000)
+
+	// So does one close to the limit whose calls each have many locals.
+	var locals strings.Builder
+	for i := 0; i < 17; i++ {
+		fmt.Fprintf(&locals, "let l%d = %d; ", i, i)
+	}
+	deep := "fn deep(n) { " + locals.String() + "if (n == 0) { 0 } else { 1 + deep(n - 1) } }\ndeep(60000)"
+	testIntegerObject(t, testEval(t, deep), 60000)
+}
+
+func TestStackTraces(t *testing.T) {
+	type frame struct {
+		function string
+		pos      string
+		args     string
+	}
+
+	tests := []struct {
+		input    string
+		expected []frame
+	}{
+		{"1 / 0", nil},
+		{
+			"fn divide(a, b) { a / b }\ndivide(1, 0)",
+			[]frame{{"divide", "2:7", "1, 0"}},
+		},
+		{
+			"let inner = fn(x) { x + true };\nlet outer = fn(s, xs) { inner(len(xs)) };\nouter(\"abc\", [1, 2])",
+			[]frame{{"inner", "2:30", "2"}, {"outer", "3:6", `"abc", [1, 2]`}},
+		},
+		{
+			"let f = fn(n) { n -= 1; if (n == 0) { [][0] } else { f(n) } };\nf(2)",
+			[]frame{{"f", "1:55", "1"}, {"f", "2:2", "2"}},
+		},
+		{"fn f(n) { n = 0; 1 / n }\nf(5)", []frame{{"f", "2:2", "5"}}},
+		{
+			"(fn(x) { x() })(fn() { -\"a\" })",
+			[]frame{{"<anonymous>", "1:11", ""}, {"<anonymous>", "1:16", "fn() {\n(-a)\n}"}},
+		},
+		{
+			"const f = fn(s) { s + 1 };\nf(\"a string that is too long to show\")",
+			[]frame{{"f", "2:2", `"a string that is...`}},
+		},
+		{"fn f(a) { a }\nf(1, 2)", nil},
+		{"fn f() { missing }\nlet g = fn() { f() };\ng()", []frame{{"f", "2:17", ""}, {"g", "3:2", ""}}},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%q: no error object returned. got=%T (%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		var got []frame
+		for _, f := range errObj.Frames {
+			got = append(got, frame{f.Function, f.Pos.String(), f.Args})
+		}
+
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("%q: wrong frames.\nwant=%+v\ngot=%+v", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input       string
+		expectedPos string
+	}{
+		{"5 + true;", "1:3"},
+		{"let x = 1;\n  foobar;", "2:3"},
+		{"let f = fn() {\n  1 - \"a\"\n};\nf();", "2:5"},
+		{"-true", "1:1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Pos.String() != tt.expectedPos {
+			t.Errorf("wrong error position. expected=%q, got=%q", tt.expectedPos, errObj.Pos.String())
+		}
+	}
+}
+
 func TestLetStatements(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -210,14 +657,14 @@ func TestLetStatements(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
 	}
 }
 
 func TestFunctionObject(t *testing.T) {
 	input := "fn(x) { x + 2; };"
 
-	evaluated := testEval(input)
+	evaluated := testEval(t, input)
 
 	fn, ok := evaluated.(*object.Function)
 
@@ -254,17 +701,684 @@ func TestFunctionApplication(t *testing.T) {
 	}
 
 	for _, tt := range tests {
-		testIntegerObject(t, testEval(tt.input), tt.expected)
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestClosures(t *testing.T) {
+	input := `
+	let newAdder = fn(x) {
+		fn(y) { x + y };
+	};
+
+	let addTwo = newAdder(2);
+	addTwo(2);
+	`
+
+	testIntegerObject(t, testEval(t, input), 4)
+}
+
+func TestClosuresOverLaterLocals(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"let f = fn() { let g = fn() { A }; let A = 1; g() }; f()", 1},
+		{"let A = 5; let f = fn() { let x = A; let A = 1; x }; f()", 5},
+		{"let A = 5; let f = fn() { let g = fn() { A }; let A = 1; g() + A }; f()", 2},
+		{`let f = fn(n) {
+			let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } };
+			let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } };
+			if (isEven(n)) { 1 } else { 0 }
+		};
+		f(10) + f(7)`, 1},
+		{"let f = fn() { fn even(n) { if (n == 0) { 1 } else { odd(n - 1) } } fn odd(n) { if (n == 0) { 0 } else { even(n - 1) } } even(4) }; f()", 1},
+		{"let f = fn() { let fs = []; for (x in [1, 2]) { let g = fn() { x * y }; let y = 10; fs = push(fs, g); } fs[0]() }; f()", 20},
+		{"let x = 1; fn f() { let g = fn() { x }; let a = g(); let x = 2; a } f()", 1},
+		{"fn f() { let g = fn() { len([1]) }; let r = g(); let len = 5; r } f()", 1},
+		{"let x = 1; fn f() { let g = fn() { x }; if (false) { let x = 2 } g() } f()", 1},
+		{"let x = 1; fn f() { if (false) { let x = 2 } x } f()", 1},
+		{"fn o() { let x = 7; fn f() { let g = fn() { x }; let a = g(); let x = 2; a + g() } f() } o()", 9},
+		{"let x = 1; fn o() { let h = fn() { let g = fn() { x }; g() }; let r = h(); let x = 3; r + h() } o()", 4},
+		{"let x = 1; fn f() { if (false) { let x = 2 } x = 5; x } f() + x", 10},
+		{"fn o() { let x = 1; fn f() { let g = fn() { x += 1 }; g(); let x = 10; g() + x } f() + x } o()", 24},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestRecursiveFunction(t *testing.T) {
+	input := `
+	let fib = fn(n) {
+		if (n < 2) { return n; }
+		fib(n - 1) + fib(n - 2);
+	};
+
+	fib(10);
+	`
+
+	testIntegerObject(t, testEval(t, input), 55)
+}
+
+func TestFunctionStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"fn subtract(x, y) { return x - y; } subtract(10, 3);", 7},
+		{"fn fact(n) { if (n < 2) { return 1; } n * fact(n - 1) } fact(5);", 120},
+		{"let x = 10; fn addX(y) { x + y }; addX(5);", 15},
+		{`
+		let outer = fn() {
+			fn inner(n) { if (n < 1) { return 0; } 1 + inner(n - 1) }
+			inner(3)
+		};
+		outer();
+		`, 3},
+		{"fn(x) { x * 2 }(4);", 8},
+	}
+
+	for _, tt := range tests {
+		testIntegerObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestFunctionApplicationErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"let add = fn(x, y) { x + y; }; add(1);", "wrong number of arguments: want=2, got=1"},
+		{"fn() { 1; }(1, 2);", "wrong number of arguments: want=0, got=2"},
+		{"let x = 5; x(1);", "not a function: INTEGER"},
+		{"fn(x) { x; }(foobar);", "identifier not found: foobar"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+			continue
+		}
+
+		if errObj.Message != tt.expectedMessage {
+			t.Errorf("wrong error message. expected=%q, got=%q", tt.expectedMessage, errObj.Message)
+		}
+	}
+}
+
+func TestStringLiteral(t *testing.T) {
+	input := `"Hello World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringConcatenation(t *testing.T) {
+	input := `"Hello" + " " + "World!"`
+
+	evaluated := testEval(t, input)
+	str, ok := evaluated.(*object.String)
+	if !ok {
+		t.Fatalf("object is not String. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if str.Value != "Hello World!" {
+		t.Errorf("String has wrong value. got=%q", str.Value)
+	}
+}
+
+func TestStringComparison(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{`"a" == "a"`, true},
+		{`"a" == "b"`, false},
+		{`"a" != "b"`, true},
+		{`"a" + "b" == "ab"`, true},
+	}
+
+	for _, tt := range tests {
+		testBooleanObject(t, testEval(t, tt.input), tt.expected)
+	}
+}
+
+func TestArrayLiterals(t *testing.T) {
+	input := "[1, 2 * 2, 3 + 3]"
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Array)
+	if !ok {
+		t.Fatalf("object is not Array. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	if len(result.Elements) != 3 {
+		t.Fatalf("array has wrong num of elements. got=%d", len(result.Elements))
+	}
+
+	testIntegerObject(t, result.Elements[0], 1)
+	testIntegerObject(t, result.Elements[1], 4)
+	testIntegerObject(t, result.Elements[2], 6)
+}
+
+func TestArrayIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{"[1, 2, 3][0]", 1},
+		{"[1, 2, 3][1]", 2},
+		{"[1, 2, 3][2]", 3},
+		{"let i = 0; [1][i];", 1},
+		{"[1, 2, 3][1 + 1];", 3},
+		{"let myArray = [1, 2, 3]; myArray[2];", 3},
+		{"let myArray = [1, 2, 3]; myArray[0] + myArray[1] + myArray[2];", 6},
+		{"let myArray = [1, 2, 3]; let i = myArray[0]; myArray[i]", 2},
+		{"[1, 2, 3][-1]", 3},
+		{"[1, 2, 3][-3]", 1},
+		{"[1, 2, 3][3]", "index out of range: 3 (length 3)"},
+		{"[1, 2, 3][-4]", "index out of range: -4 (length 3)"},
+		{"[][0]", "index out of range: 0 (length 0)"},
+		{`[1][true]`, "array index must be INTEGER, got BOOLEAN"},
+		{`5[0]`, "index operator not supported: INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case string:
+			errObj, ok := evaluated.(*object.Error)
+			if !ok {
+				t.Errorf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+				continue
+			}
+			if errObj.Message != expected {
+				t.Errorf("wrong error message. expected=%q, got=%q", expected, errObj.Message)
+			}
+		}
+	}
+}
+
+func TestArrayInspect(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"[]", "[]"},
+		{"[1, 2, 3]", "[1, 2, 3]"},
+		{`[1, "two", [true, "a\"b\n"]]`, `[1, "two", [true, "a\"b\n"]]`},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if evaluated.Inspect() != tt.expected {
+			t.Errorf("wrong Inspect(). expected=%q, got=%q", tt.expected, evaluated.Inspect())
+		}
+	}
+}
+
+func TestHashLiterals(t *testing.T) {
+	input := `let two = "two";
+	let h = {
+		"one": 10 - 9,
+		two: 1 + 1,
+		"thr" + "ee": 6 / 2,
+		4: 4,
+		true: 5,
+		false: 6
+	};
+	h`
+
+	evaluated := testEval(t, input)
+	result, ok := evaluated.(*object.Hash)
+	if !ok {
+		t.Fatalf("Eval didn't return Hash. got=%T (%+v)", evaluated, evaluated)
+	}
+
+	expected := map[object.HashKey]int64{
+		(&object.String{Value: "one"}).HashKey():   1,
+		(&object.String{Value: "two"}).HashKey():   2,
+		(&object.String{Value: "three"}).HashKey(): 3,
+		(&object.Integer{Value: 4}).HashKey():      4,
+		evaluator.TRUE.HashKey():                   5,
+		evaluator.FALSE.HashKey():                  6,
+	}
+
+	if len(result.Pairs) != len(expected) {
+		t.Fatalf("Hash has wrong num of pairs. got=%d", len(result.Pairs))
+	}
+
+	for expectedKey, expectedValue := range expected {
+		pair, ok := result.Pairs[expectedKey]
+		if !ok {
+			t.Errorf("no pair for given key in Pairs")
+		}
+
+		testIntegerObject(t, pair.Value, expectedValue)
+	}
+
+	if result.Inspect() != `{"one": 1, "two": 2, "three": 3, 4: 4, true: 5, false: 6}` {
+		t.Errorf("wrong Inspect(). got=%q", result.Inspect())
+	}
+}
+
+func TestHashIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`{"foo": 5}["foo"]`, 5},
+		{`{"foo": 5}["bar"]`, nil},
+		{`let key = "foo"; {"foo": 5}[key]`, 5},
+		{`{}["foo"]`, nil},
+		{`{5: 5}[5]`, 5},
+		{`{true: 5}[true]`, 5},
+		{`{false: 5}[false]`, 5},
+		{`{"a": 1, "a": 2}["a"]`, 2},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		integer, ok := tt.expected.(int)
+		if ok {
+			testIntegerObject(t, evaluated, int64(integer))
+		} else {
+			testNullObject(t, evaluated)
+		}
+	}
+}
+
+func TestBuiltinFunctions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`len("")`, 0},
+		{`len("four")`, 4},
+		{`len("hello world")`, 11},
+		{`len("größe")`, 5},
+		{`len(1)`, "argument to `len` not supported, got INTEGER"},
+		{`len("one", "two")`, "wrong number of arguments: want=1, got=2"},
+		{`len([1, 2, 3])`, 3},
+		{`len([])`, 0},
+		{`len({"a": 1, "b": 2})`, 2},
+		{`first([1, 2, 3])`, 1},
+		{`first([])`, nil},
+		{`first(1)`, "argument to `first` must be ARRAY, got INTEGER"},
+		{`last([1, 2, 3])`, 3},
+		{`last([])`, nil},
+		{`last(1)`, "argument to `last` must be ARRAY, got INTEGER"},
+		{`rest([1, 2, 3])`, []int{2, 3}},
+		{`rest([])`, nil},
+		{`push([], 1)`, []int{1}},
+		{`push(1, 1)`, "argument to `push` must be ARRAY, got INTEGER"},
+		{`let a = [1]; push(a, 2); a`, []int{1}},
+		{`puts("hello", 1)`, nil},
+		{`type(1)`, "INTEGER"},
+		{`type("a")`, "STRING"},
+		{`type(fn(x) { x })`, "FUNCTION"},
+		{`type(len)`, "BUILTIN"},
+		{`let len = fn(x) { 42 }; len("a")`, 42},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		switch expected := tt.expected.(type) {
+		case int:
+			testIntegerObject(t, evaluated, int64(expected))
+		case nil:
+			testNullObject(t, evaluated)
+		case string:
+			switch result := evaluated.(type) {
+			case *object.Error:
+				if result.Message != expected {
+					t.Errorf("wrong error message. expected=%q, got=%q", expected, result.Message)
+				}
+			case *object.String:
+				if result.Value != expected {
+					t.Errorf("wrong string. expected=%q, got=%q", expected, result.Value)
+				}
+			default:
+				t.Errorf("object is not Error or String. got=%T (%+v)", evaluated, evaluated)
+			}
+		case []int:
+			array, ok := evaluated.(*object.Array)
+			if !ok {
+				t.Errorf("obj not Array. got=%T (%+v)", evaluated, evaluated)
+				continue
+			}
+
+			if len(array.Elements) != len(expected) {
+				t.Errorf("wrong num of elements. want=%d, got=%d", len(expected), len(array.Elements))
+				continue
+			}
+
+			for i, expectedElem := range expected {
+				testIntegerObject(t, array.Elements[i], int64(expectedElem))
+			}
+		}
+	}
+}
+
+func TestLoops(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let i = 0; let sum = 0; while (i < 5) { let sum = sum + i; let i = i + 1; } sum", "10"},
+		{"let n = 0; while (false) { let n = 1; } n", "0"},
+		{"let sum = 0; for (let i = 1; i <= 100; let i = i + 1) { let sum = sum + i; } sum", "5050"},
+		{"let sum = 0; for (let i = 0; i < 10; let i = i + 1) { if (i % 2 == 0) { continue; } let sum = sum + i; } sum", "25"},
+		{"let i = 0; for (;;) { if (i == 3) { break; } let i = i + 1; } i", "3"},
+		{"let out = []; for (x in [1, 2, 3]) { let out = push(out, x * 10); } out", "[10, 20, 30]"},
+		{`let keys = []; for (k in {"b": 1, "a": 2}) { let keys = push(keys, k); } keys`, `["b", "a"]`},
+		{`let cs = []; for (c in "héllo") { let cs = push(cs, c); } cs`, `["h", "é", "l", "l", "o"]`},
+		{"let n = 0; for (x in []) { let n = n + 1; } n", "0"},
+		{"let seen = 0; for (x in [1, 2, 3, 4]) { if (x == 3) { break; } let seen = x; } seen", "2"},
+		{
+			"let pairs = 0; for (x in [1, 2, 3]) { for (y in [1, 2, 3]) { if (y > x) { break; } let pairs = pairs + 1; } } pairs",
+			"6",
+		},
+		{"let find = fn(xs, v) { for (x in xs) { if (x == v) { return true; } } false }; [find([1, 2], 2), find([1, 2], 3)]", "[true, false]"},
+		{"let f = fn() { let i = 0; while (true) { let i = i + 1; if (i > 4) { return i; } } }; f()", "5"},
+		{"let i = 0; while (i < 100000) { let i = i + 1; } i", "100000"},
+		{"let fs = []; for (x in [1, 2]) { let fs = push(fs, fn() { x }); } fs[0]()", "2"},
+		{"while (false) { 1 }", "<nil>"},
+		{"if (true) { for (x in [1]) { x } }", "null"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if got := describeValue(evaluated); got != tt.expected {
+			t.Errorf("%s: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLoopSignalsInExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let i = 0; let out = []; while (i < 3) { i += 1; out = push(out, if (i == 2) { break; } else { i }); } [i, out]", "[2, [1]]"},
+		{"let i = 0; let out = []; while (i < 3) { i += 1; out = push(out, if (i == 2) { continue; } else { i }); } out", "[1, 3]"},
+		{"let n = 0; for (let i = 0; i < 5; i += 1) { let x = if (i % 2 == 0) { continue; } else { i }; n += x; } n", "4"},
+		{"let n = 0; for (x in [1, 2, 3]) { n += if (x == 3) { break; } else { x }; } n", "3"},
+		{"let a = [0]; for (x in [1, 2, 3]) { a[0] += if (x == 3) { break; } else { x }; } a", "[3]"},
+		{"let r = []; for (x in [1, 2]) { for (y in [1, 2]) { r = push(r, {x: [y, if (y == 2) { break; } else { y }]}); } } len(r)", "2"},
+		{"let i = 0; while (i < 100000) { i += 1; len(if (true) { continue; }); } i", "100000"},
+		{"let i = 0; while (i < 100000) { i += 1; 1 + -(if (true) { continue; }); } i", "100000"},
+		{"let f = fn() { let x = if (true) { return 5; }; 10 }; f()", "5"},
+		{"let f = fn() { for (x in [1, 2]) { [x, if (x == 1) { return x; }] } }; f()", "1"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if got := describeValue(evaluated); got != tt.expected {
+			t.Errorf("%s: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLoopErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"for (x in 5) { x }", "1:1: cannot iterate over INTEGER"},
+		{"while (1 + true) { }", "1:10: type mismatch: INTEGER + BOOLEAN"},
+		{"let i = 0; while (true) { let i = i + 1; if (i == 3) { i + true } }", "1:58: type mismatch: INTEGER + BOOLEAN"},
+		{"for (let i = 0; i < 2; i + true) { }", "1:26: type mismatch: INTEGER + BOOLEAN"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if got := errObj.Pos.String() + ": " + errObj.Message; got != tt.expectedMessage {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expectedMessage, got)
+		}
+	}
+}
+
+func TestAssignment(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x = 1; x = 2; x", "2"},
+		{"let x = 1; x = 2", "2"},
+		{"let a = 1; let b = 2; a = b = 3; [a, b]", "[3, 3]"},
+		{"let x = 10; x += 5; x -= 3; x *= 2; x /= 4; x %= 4; x", "2"},
+		{"let x = 1.5; x *= 2; x", "3.0"},
+		{`let s = "a"; s += "b"; s`, "ab"},
+		{"let x = 1; let f = fn() { x = 5; }; f(); x", "5"},
+		{"let x = 1; let f = fn() { let x = 2; x = 3; x }; [f(), x]", "[3, 1]"},
+		{"let f = fn(n) { n += 1; n }; let n = 10; [f(1), n]", "[2, 10]"},
+		{"let counter = fn() { let n = 0; fn() { n += 1; n } }; let c = counter(); c(); c(); c()", "3"},
+		{"let make = fn() { let n = 0; [fn() { n += 1 }, fn() { n }] }; let fs = make(); fs[0](); fs[0](); fs[1]()", "2"},
+		{"let sum = 0; for (let i = 0; i < 5; i += 1) { sum += i; } sum", "10"},
+		{"let i = 0; while (i < 3) { i = i + 1; } i", "3"},
+		{"let xs = [1, 2, 3]; xs[0] = 10; xs[-1] += 5; xs", "[10, 2, 8]"},
+		{"let xs = [1, 2]; let ys = xs; ys[0] = 9; xs", "[9, 2]"},
+		{`let h = {"a": 1}; h["a"] += 1; h["b"] = 5; h`, `{"a": 2, "b": 5}`},
+		{"let grid = [[0, 0], [0, 0]]; grid[1][0] = 7; grid", "[[0, 0], [7, 0]]"},
+		{"let xs = [0]; xs[0] = 4", "4"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if got := describeValue(evaluated); got != tt.expected {
+			t.Errorf("%s: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestAssignmentErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"x = 1", "1:3: assignment to undeclared variable: x"},
+		{"let f = fn() { y = 1 }; f()", "1:18: assignment to undeclared variable: y"},
+		{"x += 1", "1:1: identifier not found: x"},
+		{"let x = 1; x += true", "1:14: type mismatch: INTEGER + BOOLEAN"},
+		{"let x = 1; x /= 0", "1:14: division by zero: 1 / 0"},
+		{"let xs = [1]; xs[1] = 2", "1:21: index out of range: 1 (length 1)"},
+		{`let xs = [1]; xs["a"] = 2`, "1:23: array index must be INTEGER, got STRING"},
+		{"let h = {}; h[fn() {}] = 1", "1:24: unusable as hash key: FUNCTION"},
+		{`let s = "ab"; s[0] = "c"`, "1:20: index assignment not supported: STRING"},
+		{`let h = {}; h["a"] += 1`, "1:20: type mismatch: NULL + INTEGER"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if got := errObj.Pos.String() + ": " + errObj.Message; got != tt.expectedMessage {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expectedMessage, got)
+		}
+	}
+}
+
+func TestConstStatements(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"const x = 5; x", "5"},
+		{"const x = 5; let f = fn() { let x = 1; x += 1; x }; [f(), x]", "[2, 5]"},
+		{"const n = 3; let f = fn(n) { n = n * 2; n }; [f(1), n]", "[2, 3]"},
+		{"let x = 1; x = 2; const x = x + 1; x", "3"},
+		{"const xs = [1, 2]; xs[0] = 5; xs", "[5, 2]"},
+		{"const fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } }; fact(5)", "120"},
+	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+		if got := describeValue(evaluated); got != tt.expected {
+			t.Errorf("%s: wrong result. want=%s, got=%s", tt.input, tt.expected, got)
+		}
+	}
+}
+
+// The parser rejects most of these programs. The statements it complains
+// about are still in the AST, which checks that evaluation catches them too.
+func TestConstErrors(t *testing.T) {
+	tests := []struct {
+		input           string
+		expectedMessage string
+	}{
+		{"const x = 1; x = 2", "1:16: cannot assign to constant: x"},
+		{"const x = 1; x += 2", "1:16: cannot assign to constant: x"},
+		{"let f = fn() { x = 2 }; const x = 1; f()", "1:18: cannot assign to constant: x"},
+		{"const x = 1; let f = fn() { x = 2 }; f()", "1:31: cannot assign to constant: x"},
+		{"const x = 1; let x = 2", "1:14: cannot redeclare constant: x"},
+		{"const x = 1; const x = 2", "1:14: cannot redeclare constant: x"},
+		{"const x = 1; fn x() { 2 }", "1:14: cannot redeclare constant: x"},
+		{"const x = 1; for (x in [1]) { }", "1:14: cannot redeclare constant: x"},
 	}
+
+	for _, tt := range tests {
+		evaluated := testEval(t, tt.input)
+
+		errObj, ok := evaluated.(*object.Error)
+		if !ok {
+			t.Errorf("%s: no error object returned. got=%T(%+v)", tt.input, evaluated, evaluated)
+			continue
+		}
+
+		if got := errObj.Pos.String() + ": " + errObj.Message; got != tt.expectedMessage {
+			t.Errorf("%s: wrong error. want=%q, got=%q", tt.input, tt.expectedMessage, got)
+		}
+	}
+}
+
+// The REPL parses each input on its own, so only evaluation can catch an
+// assignment to a constant declared by an earlier input.
+func TestConstAcrossInputs(t *testing.T) {
+	env := object.NewEnvironment()
+	evaluator.Eval(parser.New(lexer.New("const limit = 10;")).ParseProgram(), env)
+	evaluated := evaluator.Eval(parser.New(lexer.New("limit = 11;")).ParseProgram(), env)
+
+	errObj, ok := evaluated.(*object.Error)
+	if !ok {
+		t.Fatalf("no error object returned. got=%T(%+v)", evaluated, evaluated)
+	}
+
+	if errObj.Message != "cannot assign to constant: limit" {
+		t.Errorf("wrong error message. got=%q", errObj.Message)
+	}
+}
+
+func TestRegisterBuiltin(t *testing.T) {
+	evaluator.RegisterBuiltin("double", func(args ...object.Object) object.Object {
+		return &object.Integer{Value: args[0].(*object.Integer).Value * 2}
+	})
+
+	testIntegerObject(t, testEval(t, "double(21)"), 42)
 }
 
-func testEval(input string) object.Object {
+// testEval evaluates input with the tree-walking evaluator and with the
+// compiler and VM, reports any difference between the two, and returns the
+// evaluator's result.
+func testEval(t *testing.T, input string) object.Object {
+	t.Helper()
+
 	l := lexer.New(input)
 	p := parser.New(l)
 	program := p.ParseProgram()
 	env := object.NewEnvironment()
 
-	return Eval(program, env)
+	evaluated := evaluator.Eval(program, env)
+
+	compiled := runVM(t, program)
+	if !sameResult(evaluated, compiled) {
+		t.Errorf("backends disagree on %q:\n  eval: %s\n  vm:   %s", input, describe(evaluated), describe(compiled))
+	}
+
+	return evaluated
+}
+
+func runVM(t *testing.T, program *ast.Program) object.Object {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(program); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := vm.New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		errObj, ok := err.(*object.Error)
+		if !ok {
+			t.Fatalf("vm error: %s", err)
+		}
+		return errObj
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+func sameResult(a, b object.Object) bool {
+	if a == nil || b == nil {
+		return a == nil && b == nil
+	}
+
+	if errA, ok := a.(*object.Error); ok {
+		if errB, ok := b.(*object.Error); ok && !reflect.DeepEqual(errA.Frames, errB.Frames) {
+			return false
+		}
+	}
+
+	return a.Type() == b.Type() && a.Inspect() == b.Inspect()
+}
+
+// describeValue returns obj's Inspect, or <nil> for a missing value.
+func describeValue(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+
+	return obj.Inspect()
+}
+
+func describe(obj object.Object) string {
+	if obj == nil {
+		return "<nil>"
+	}
+
+	if errObj, ok := obj.(*object.Error); ok && len(errObj.Frames) > 0 {
+		return fmt.Sprintf("%s %s %+v", obj.Type(), obj.Inspect(), errObj.Frames)
+	}
+
+	return fmt.Sprintf("%s %s", obj.Type(), obj.Inspect())
 }
 
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) bool {
@@ -294,7 +1408,7 @@ func testBooleanObject(t *testing.T, obj object.Object, expected bool) bool {
 }
 
 func testNullObject(t *testing.T, obj object.Object) bool {
-	if obj != NULL {
+	if obj != evaluator.NULL {
 		t.Errorf("object is not NULL. got=%T (%+v)", obj, obj)
 		return false
 	}
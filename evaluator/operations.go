@@ -0,0 +1,72 @@
+package evaluator
+
+import "mana/object"
+
+// The functions in this file expose the evaluator's operator semantics to
+// other backends, so that the bytecode VM computes exactly the same values
+// and errors as Eval. Errors they return carry no position yet; the caller
+// stamps it.
+
+// PrefixOperation applies a prefix operator such as "-" or "!".
+func PrefixOperation(operator string, right object.Object) object.Object {
+	return evalPrefixExpression(operator, right)
+}
+
+// InfixOperation applies an infix operator such as "+" or "==".
+func InfixOperation(operator string, left, right object.Object) object.Object {
+	return evalInfixExpression(operator, left, right)
+}
+
+// IndexOperation evaluates left[index].
+func IndexOperation(left, index object.Object) object.Object {
+	return evalIndexExpression(left, index)
+}
+
+// SetIndexOperation evaluates left[index] = val.
+func SetIndexOperation(left, index, val object.Object) object.Object {
+	return evalIndexAssignment(left, index, val)
+}
+
+// HashOperation builds a hash from evaluated key/value pairs.
+func HashOperation(pairs []object.HashPair) object.Object {
+	return buildHash(pairs)
+}
+
+// IterationValues returns the values a for-in loop over iterable visits, or an
+// error if iterable cannot be iterated over.
+func IterationValues(iterable object.Object) ([]object.Object, *object.Error) {
+	return iterationValues(iterable)
+}
+
+// IsTruthy reports whether obj counts as true in a condition.
+func IsTruthy(obj object.Object) bool {
+	return isTruthy(obj)
+}
+
+// NativeBool returns the TRUE or FALSE singleton for b.
+func NativeBool(b bool) *object.Boolean {
+	return nativeBoolToBooleanObject(b)
+}
+
+// LookupBuiltin returns the builtin registered under name.
+func LookupBuiltin(name string) (*object.Builtin, bool) {
+	builtin, ok := builtins[name]
+	return builtin, ok
+}
+
+// ValueOrNull returns NULL in place of a missing value.
+func ValueOrNull(obj object.Object) object.Object {
+	return valueOrNull(obj)
+}
+
+// IsLogicalOperator reports whether operator is one of the short-circuiting
+// operators &&, || and ??.
+func IsLogicalOperator(operator string) bool {
+	return isLogicalOperator(operator)
+}
+
+// ShortCircuit decides a logical operator from its left operand alone. It
+// reports false if the right operand has to be evaluated.
+func ShortCircuit(operator string, left object.Object) (object.Object, bool) {
+	return shortCircuit(operator, left)
+}
@@ -1,60 +1,155 @@
 package lexer
 
-import "mana/tokens"
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mana/tokens"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
+// Lexer turns UTF-8 source text into tokens. It works on runes: identifiers
+// may contain any Unicode letter or digit, and columns in token positions
+// count runes, while offsets count bytes. The source is read through a
+// buffer as the tokens are requested, so it never has to be in memory as a
+// whole.
 type Lexer struct {
-	input        string
-	position     int  // current position in input (points to current char)
-	readPosition int  // current reading position in input (after current char)
-	ch           byte // current char under examination
+	reader   *bufio.Reader
+	filename string            // name reported in token positions
+	failed   bool              // reader has returned an error and is not read again
+	err      error             // error from reader, until it is reported as an ILLEGAL token
+	position int               // offset of the current char in bytes
+	raw      [utf8.UTFMax]byte // bytes of the current char
+	width    int               // number of bytes in raw
+	ch       rune              // current char under examination
+	invalid  bool              // ch is utf8.RuneError standing in for a byte that is not valid UTF-8
+	line     int               // line of the current char, starting at 1
+	column   int               // column of the current char in runes, starting at 1
+	lexeme   *strings.Builder  // if set, collects the bytes of the chars read
 }
 
 // New returns a new Lexer instance.
 func New(input string) *Lexer {
-	var l *Lexer = &Lexer{input: input}
+	return NewFile("", input)
+}
+
+// NewFile returns a new Lexer instance whose token positions report the given
+// file name.
+func NewFile(filename string, input string) *Lexer {
+	return NewFileReader(filename, strings.NewReader(input))
+}
+
+// NewReader returns a new Lexer instance that reads its input from r. It
+// produces the same tokens as New does for the whole input.
+func NewReader(r io.Reader) *Lexer {
+	return NewFileReader("", r)
+}
+
+// NewFileReader returns a new Lexer instance that reads its input from r and
+// whose token positions report the given file name.
+func NewFileReader(filename string, r io.Reader) *Lexer {
+	var l *Lexer = &Lexer{reader: bufio.NewReader(r), filename: filename, line: 1}
 	l.readChar()
 	return l
 }
 
-// NextToken returns the next token in the input string.
+// NextToken returns the next token in the input.
 func (l *Lexer) NextToken() tokens.Token {
 	var tok tokens.Token
 
-	l.skipWhitespace()
+	if start, ok := l.skipWhitespace(); !ok {
+		return tokens.Token{Type: tokens.ILLEGAL, Literal: "unterminated block comment", Pos: start}
+	}
+
+	var pos tokens.Position = l.currentPosition()
 
 	switch l.ch {
 	case '=':
 		if l.peekChar() == '=' {
-			var ch byte = l.ch
-			l.readChar()
-			var literal string = string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.EQ, Literal: literal}
+			tok = l.readTwoCharToken(tokens.EQ)
 		} else {
 			tok = newToken(tokens.ASSIGN, l.ch)
 		}
 	case '+':
-		tok = newToken(tokens.PLUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(tokens.PLUS_ASSIGN)
+		} else {
+			tok = newToken(tokens.PLUS, l.ch)
+		}
 	case '-':
-		tok = newToken(tokens.MINUS, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(tokens.MINUS_ASSIGN)
+		} else {
+			tok = newToken(tokens.MINUS, l.ch)
+		}
 	case '/':
-		tok = newToken(tokens.SLASH, l.ch)
+		// skipWhitespace has already skipped any other kind of comment.
+		if l.peekChar() == '/' {
+			tok.Type = tokens.DOC_COMMENT
+			tok.Literal = l.readDocComment()
+			tok.Pos = pos
+			return tok
+		}
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(tokens.SLASH_ASSIGN)
+		} else {
+			tok = newToken(tokens.SLASH, l.ch)
+		}
 	case '*':
-		tok = newToken(tokens.ASTERISK, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(tokens.ASTERISK_ASSIGN)
+		} else {
+			tok = newToken(tokens.ASTERISK, l.ch)
+		}
+	case '%':
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(tokens.PERCENT_ASSIGN)
+		} else {
+			tok = newToken(tokens.PERCENT, l.ch)
+		}
 	case '<':
-		tok = newToken(tokens.LT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(tokens.LT_EQ)
+		} else {
+			tok = newToken(tokens.LT, l.ch)
+		}
 	case '>':
-		tok = newToken(tokens.GT, l.ch)
+		if l.peekChar() == '=' {
+			tok = l.readTwoCharToken(tokens.GT_EQ)
+		} else {
+			tok = newToken(tokens.GT, l.ch)
+		}
+	case '&':
+		if l.peekChar() == '&' {
+			tok = l.readTwoCharToken(tokens.AND)
+		} else {
+			tok = newToken(tokens.ILLEGAL, l.ch)
+		}
+	case '|':
+		if l.peekChar() == '|' {
+			tok = l.readTwoCharToken(tokens.OR)
+		} else {
+			tok = newToken(tokens.ILLEGAL, l.ch)
+		}
+	case '?':
+		if l.peekChar() == '?' {
+			tok = l.readTwoCharToken(tokens.NULLISH)
+		} else {
+			tok = newToken(tokens.ILLEGAL, l.ch)
+		}
 	case '!':
 		if l.peekChar() == '=' {
-			var ch byte = l.ch
-			l.readChar()
-			var literal string = string(ch) + string(l.ch)
-			tok = tokens.Token{Type: tokens.NOT_EQ, Literal: literal}
+			tok = l.readTwoCharToken(tokens.NOT_EQ)
 		} else {
 			tok = newToken(tokens.BANG, l.ch)
 		}
 	case ';':
 		tok = newToken(tokens.SEMICOLON, l.ch)
+	case ':':
+		tok = newToken(tokens.COLON, l.ch)
 	case '(':
 		tok = newToken(tokens.LPAREN, l.ch)
 	case ')':
@@ -65,83 +160,448 @@ func (l *Lexer) NextToken() tokens.Token {
 		tok = newToken(tokens.LBRACE, l.ch)
 	case '}':
 		tok = newToken(tokens.RBRACE, l.ch)
+	case '[':
+		tok = newToken(tokens.LBRACKET, l.ch)
+	case ']':
+		tok = newToken(tokens.RBRACKET, l.ch)
+	case '"':
+		if str, ok := l.readString(); ok {
+			tok = tokens.Token{Type: tokens.STRING, Literal: str}
+		} else {
+			tok = tokens.Token{Type: tokens.ILLEGAL, Literal: str}
+		}
 	case 0:
+		if l.err != nil {
+			tok = tokens.Token{Type: tokens.ILLEGAL, Literal: "read error: " + l.err.Error()}
+			l.err = nil
+			tok.Pos = pos
+			return tok
+		}
 		tok.Literal = ""
 		tok.Type = tokens.EOF
 	default:
-		if isLetter(l.ch) {
+		if l.invalid {
+			tok = tokens.Token{Type: tokens.ILLEGAL, Literal: l.invalidEncoding()}
+		} else if isLetter(l.ch) {
 			tok.Literal = l.readIdentifier()
 			tok.Type = tokens.LookupIdent(tok.Literal)
+			tok.Pos = pos
 			return tok
 		} else if isDigit(l.ch) {
-			tok.Type = tokens.INT
-			tok.Literal = l.readNumber()
+			tok.Literal, tok.Type = l.readNumber()
+			tok.Pos = pos
 			return tok
 		} else {
 			tok = newToken(tokens.ILLEGAL, l.ch)
 		}
 	}
 
+	tok.Pos = pos
 	l.readChar()
 	return tok
 }
 
-// skipWhitespace skips whitespace characters.
-func (l *Lexer) skipWhitespace() {
-	for l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r' {
+// skipWhitespace skips whitespace characters, // line comments and /* */
+// block comments, which may nest. It stops at a /// doc comment, which is
+// returned as a token. If a block comment is not terminated, it returns false
+// along with the position where the comment started.
+func (l *Lexer) skipWhitespace() (tokens.Position, bool) {
+	for {
+		switch {
+		case l.ch == ' ' || l.ch == '\t' || l.ch == '\n' || l.ch == '\r':
+			l.readChar()
+		case l.ch == '/' && l.peekChar() == '/' && !l.atDocComment():
+			l.skipLineComment()
+		case l.ch == '/' && l.peekChar() == '*':
+			var start tokens.Position = l.currentPosition()
+			if !l.skipBlockComment() {
+				return start, false
+			}
+		default:
+			return tokens.Position{}, true
+		}
+	}
+}
+
+// atDocComment reports whether the '/' at the current position starts a ///
+// doc comment. Four or more slashes make an ordinary comment.
+func (l *Lexer) atDocComment() bool {
+	var next []byte = l.peekBytes(3)
+	return len(next) >= 2 && next[0] == '/' && next[1] == '/' && (len(next) == 2 || next[2] != '/')
+}
+
+// skipLineComment skips a comment up to, but not including, the end of the line.
+func (l *Lexer) skipLineComment() {
+	for l.ch != '\n' && l.ch != 0 {
+		l.readChar()
+	}
+}
+
+// skipBlockComment skips a block comment, including any comments nested in
+// it. It reports false if the input ends before the comment is closed.
+func (l *Lexer) skipBlockComment() bool {
+	var depth int = 0
+
+	for l.ch != 0 {
+		switch {
+		case l.ch == '/' && l.peekChar() == '*':
+			depth++
+			l.readChar()
+		case l.ch == '*' && l.peekChar() == '/':
+			depth--
+			l.readChar()
+		}
+		l.readChar()
+
+		if depth == 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// readDocComment reads a /// doc comment and returns its text, without the
+// slashes and the space that usually follows them.
+func (l *Lexer) readDocComment() string {
+	for i := 0; i < 3; i++ {
 		l.readChar()
 	}
+
+	l.startLexeme()
+	l.skipLineComment()
+
+	var text string = strings.TrimSuffix(l.endLexeme(), "\r")
+	return strings.TrimPrefix(text, " ")
 }
 
 // newToken returns a new Token instance.
-func newToken(tokenType tokens.TokenType, ch byte) tokens.Token {
+func newToken(tokenType tokens.TokenType, ch rune) tokens.Token {
 	return tokens.Token{Type: tokenType, Literal: string(ch)}
 }
 
-// isLetter returns true if the given character is a letter.
-func isLetter(ch byte) bool {
-	return 'a' <= ch && ch <= 'z' || 'A' <= ch && ch <= 'Z' || ch == '_'
+// readTwoCharToken reads a token made of the current and the next character,
+// such as "==". It leaves the lexer on the second character.
+func (l *Lexer) readTwoCharToken(tokenType tokens.TokenType) tokens.Token {
+	var ch rune = l.ch
+	l.readChar()
+	var literal string = string(ch) + string(l.ch)
+	return tokens.Token{Type: tokenType, Literal: literal}
+}
+
+// isLetter returns true if the given character can start an identifier: a
+// Unicode letter or '_'.
+func isLetter(ch rune) bool {
+	return ch == '_' || unicode.IsLetter(ch)
 }
 
-// isDigit returns true if the given character is a digit.
-func isDigit(ch byte) bool {
+// isIdentifierChar returns true if the given character can continue an
+// identifier: a Unicode letter or digit, or '_'.
+func isIdentifierChar(ch rune) bool {
+	return isLetter(ch) || unicode.IsDigit(ch)
+}
+
+// isDigit returns true if the given character is an ASCII digit, as used in
+// number literals.
+func isDigit(ch rune) bool {
 	return '0' <= ch && ch <= '9'
 }
 
-// readChar reads the next character in the input and advances the position in the input string.
+// isHexDigit returns true if the given character is a hexadecimal digit.
+func isHexDigit(ch rune) bool {
+	return isDigit(ch) || ('a' <= ch && ch <= 'f') || ('A' <= ch && ch <= 'F')
+}
+
+// currentPosition returns the position of the current character.
+func (l *Lexer) currentPosition() tokens.Position {
+	return tokens.Position{
+		Filename: l.filename,
+		Offset:   l.position,
+		Line:     l.line,
+		Column:   l.column,
+	}
+}
+
+// readChar decodes the next character in the input and advances the position
+// in the input. A byte that is not part of a valid UTF-8 sequence is read on
+// its own as utf8.RuneError, with invalid set.
 func (l *Lexer) readChar() {
-	if l.readPosition >= len(l.input) {
-		l.ch = 0 // ASCII code for "NUL" character
+	if l.lexeme != nil {
+		l.lexeme.Write(l.raw[:l.width])
+	}
+
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	l.position += l.width
+
+	var next []byte = l.peekBytes(utf8.UTFMax)
+	if len(next) == 0 {
+		l.ch, l.width = 0, 0 // ASCII code for "NUL" character
 	} else {
-		l.ch = l.input[l.readPosition]
+		l.ch, l.width = utf8.DecodeRune(next)
 	}
-	l.position = l.readPosition
-	l.readPosition++
+	l.invalid = l.ch == utf8.RuneError && l.width == 1
+
+	copy(l.raw[:], next[:l.width])
+	l.reader.Discard(l.width)
+	l.column++
 }
 
-// peekChar returns the next character in the input string without advancing the position in the input string.
-func (l *Lexer) peekChar() byte {
-	if l.readPosition >= len(l.input) {
+// peekChar returns the next character in the input without advancing the position in the input.
+func (l *Lexer) peekChar() rune {
+	var next []byte = l.peekBytes(utf8.UTFMax)
+	if len(next) == 0 {
 		return 0 // ASCII code for "NUL" character
-	} else {
-		return l.input[l.readPosition]
 	}
+	ch, _ := utf8.DecodeRune(next)
+	return ch
+}
+
+// peekBytes returns up to n bytes following the current character without
+// consuming them. Fewer bytes are returned at the end of the input. The first
+// error other than io.EOF is kept in err, and the input ends there.
+func (l *Lexer) peekBytes(n int) []byte {
+	if l.failed {
+		n = min(n, l.reader.Buffered())
+	}
+
+	next, err := l.reader.Peek(n)
+	if err != nil && err != io.EOF && !l.failed {
+		l.failed = true
+		l.err = err
+	}
+	return next
 }
 
-// readIdentifier reads an identifier and advances the position in the input string until it encounters a non-letter character.
+// startLexeme starts collecting the characters that are read, beginning with
+// the current one.
+func (l *Lexer) startLexeme() {
+	l.lexeme = &strings.Builder{}
+}
+
+// endLexeme stops collecting characters and returns those read since
+// startLexeme, up to but not including the current one.
+func (l *Lexer) endLexeme() string {
+	var text string = l.lexeme.String()
+	l.lexeme = nil
+	return text
+}
+
+// invalidEncoding describes the invalid byte at the current position.
+func (l *Lexer) invalidEncoding() string {
+	return fmt.Sprintf("invalid UTF-8 encoding: byte 0x%02x", l.raw[0])
+}
+
+// readIdentifier reads an identifier and advances the position in the input until it encounters a character that cannot be part of it.
 func (l *Lexer) readIdentifier() string {
-	var position int = l.position
-	for isLetter(l.ch) {
+	l.startLexeme()
+	for isIdentifierChar(l.ch) {
 		l.readChar()
 	}
-	return l.input[position:l.position]
+	return l.endLexeme()
 }
 
-// readNumber reads a number and advances the position in the input string until it encounters a non-digit character.
-func (l *Lexer) readNumber() string {
-	var position int = l.position
-	for isDigit(l.ch) {
+// readNumber reads an integer or floating-point literal such as 42, 3.14,
+// 1e-9, 1_000.5 or 0xFF. A float needs a digit after its decimal point, so
+// 1.foo stays an integer. If the literal is malformed, the returned type is
+// ILLEGAL and the returned string describes the problem.
+func (l *Lexer) readNumber() (string, tokens.TokenType) {
+	l.startLexeme()
+
+	if l.ch == '0' && strings.ContainsRune("xXoObB", l.peekChar()) {
+		return l.readPrefixedInteger()
+	}
+
+	var tokenType tokens.TokenType = tokens.INT
+	var ok bool = l.readDigits(isDigit)
+
+	if l.ch == '.' && isDigit(l.peekChar()) {
+		tokenType = tokens.FLOAT
+		l.readChar()
+		ok = l.readDigits(isDigit) && ok
+	}
+
+	if (l.ch == 'e' || l.ch == 'E') && l.exponentFollows() {
+		tokenType = tokens.FLOAT
+		l.readChar()
+		if l.ch == '+' || l.ch == '-' {
+			l.readChar()
+		}
+		ok = l.readDigits(isDigit) && ok
+	}
+
+	var literal string = l.endLexeme()
+	if !ok {
+		return "'_' must separate successive digits in number literal", tokens.ILLEGAL
+	}
+
+	return literal, tokenType
+}
+
+// readPrefixedInteger reads a hexadecimal, octal or binary integer literal
+// such as 0xFF, 0o17 or 0b1010. Like decimal digits, the digits may be
+// separated by underscores, and an underscore may also follow the prefix.
+func (l *Lexer) readPrefixedInteger() (string, tokens.TokenType) {
+	var name string
+	var base int
+	switch l.peekChar() {
+	case 'x', 'X':
+		name, base = "hexadecimal", 16
+	case 'o', 'O':
+		name, base = "octal", 8
+	default:
+		name, base = "binary", 2
+	}
+
+	// Decimal digits are read in any base, so that 0b12 is reported as a
+	// wrong digit rather than lexed as 0b1 followed by 2.
+	var isBaseDigit func(rune) bool = isDigit
+	if base == 16 {
+		isBaseDigit = isHexDigit
+	}
+
+	l.readChar()
+	l.readChar()
+	var ok bool = l.readDigits(isBaseDigit)
+
+	var literal string = l.endLexeme()
+	var digits string = strings.ReplaceAll(literal[2:], "_", "")
+	if digits == "" {
+		return name + " literal has no digits", tokens.ILLEGAL
+	}
+	for _, ch := range digits {
+		if isDigit(ch) && int(ch-'0') >= base {
+			return fmt.Sprintf("invalid digit %q in %s literal", ch, name), tokens.ILLEGAL
+		}
+	}
+	if !ok {
+		return "'_' must separate successive digits in number literal", tokens.ILLEGAL
+	}
+
+	return literal, tokens.INT
+}
+
+// readDigits reads a run of digits for which isBaseDigit holds, which may be
+// separated by underscores. It reports false if an underscore is not
+// followed by a digit.
+func (l *Lexer) readDigits(isBaseDigit func(rune) bool) bool {
+	var ok bool = true
+	for isBaseDigit(l.ch) || l.ch == '_' {
+		if l.ch == '_' && !isBaseDigit(l.peekChar()) {
+			ok = false
+		}
+		l.readChar()
+	}
+	return ok
+}
+
+// exponentFollows reports whether the 'e' or 'E' at the current position
+// starts an exponent, that is, whether it is followed by digits with an
+// optional sign.
+func (l *Lexer) exponentFollows() bool {
+	var next []byte = l.peekBytes(2)
+	var i int = 0
+	if i < len(next) && (next[i] == '+' || next[i] == '-') {
+		i++
+	}
+	return i < len(next) && isDigit(rune(next[i]))
+}
+
+// readString reads a double-quoted string literal, decoding escape sequences.
+// It leaves the lexer on the closing quote. If the literal is malformed, the
+// returned bool is false and the returned string describes the problem.
+func (l *Lexer) readString() (string, bool) {
+	var out strings.Builder
+
+	for {
+		l.readChar()
+
+		switch l.ch {
+		case '"':
+			return out.String(), true
+		case 0:
+			return "unterminated string literal", false
+		case '\\':
+			l.readChar()
+
+			switch l.ch {
+			case 'n':
+				out.WriteByte('\n')
+			case 't':
+				out.WriteByte('\t')
+			case 'r':
+				out.WriteByte('\r')
+			case '"':
+				out.WriteByte('"')
+			case '\\':
+				out.WriteByte('\\')
+			case 'u':
+				r, ok := l.readUnicodeEscape()
+				if !ok {
+					l.skipString()
+					return "invalid unicode escape in string literal", false
+				}
+				out.WriteRune(r)
+			case 0:
+				return "unterminated string literal", false
+			default:
+				var msg string = "unknown escape sequence \\" + string(l.ch) + " in string literal"
+				l.skipString()
+				return msg, false
+			}
+		default:
+			if l.invalid {
+				var msg string = l.invalidEncoding() + " in string literal"
+				l.skipString()
+				return msg, false
+			}
+			out.WriteRune(l.ch)
+		}
+	}
+}
+
+// readUnicodeEscape reads the {XXXX} part of a \u{XXXX} escape sequence and
+// returns the rune it denotes. It leaves the lexer on the closing brace.
+func (l *Lexer) readUnicodeEscape() (rune, bool) {
+	if l.peekChar() != '{' {
+		return 0, false
+	}
+	l.readChar()
+
+	l.readChar()
+	l.startLexeme()
+	for l.ch != '}' {
+		if l.ch == 0 || l.ch == '"' {
+			l.endLexeme()
+			return 0, false
+		}
+		l.readChar()
+	}
+	var digits string = l.endLexeme()
+
+	if len(digits) == 0 || len(digits) > 6 {
+		return 0, false
+	}
+
+	value, err := strconv.ParseUint(digits, 16, 32)
+	if err != nil || value > 0x10FFFF || (value >= 0xD800 && value <= 0xDFFF) {
+		return 0, false
+	}
+
+	return rune(value), true
+}
+
+// skipString advances past the rest of a malformed string literal so that
+// lexing can resume after its closing quote. It leaves the lexer on the
+// closing quote, or on the end of input if there is none.
+func (l *Lexer) skipString() {
+	for l.ch != '"' && l.ch != 0 {
+		if l.ch == '\\' {
+			l.readChar()
+		}
 		l.readChar()
 	}
-	return l.input[position:l.position]
 }
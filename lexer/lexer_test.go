@@ -1,8 +1,12 @@
 package lexer
 
 import (
+	"errors"
+	"io"
 	"mana/tokens"
+	"strings"
 	"testing"
+	"testing/iotest"
 )
 
 func TestNextToken(t *testing.T) {
@@ -16,7 +20,7 @@ func TestNextToken(t *testing.T) {
 
 		let result = add(five, ten);
 
-		!-/*5;
+		!-/ *5;
 		5 < 10 > 5;
 
 		if (5 < 10) {
@@ -27,6 +31,14 @@ func TestNextToken(t *testing.T) {
 
 		10 == 10;
 		10 != 9;
+		"foobar"
+		"foo bar"
+		[1, 2];
+		{"foo": "bar"}
+		7 % 3;
+		1 <= 2 >= 3 && x || y ?? z;
+		while for in break continue const
+		a += b -= c *= d /= e %= f;
 	`
 
 	var tests = []struct {
@@ -106,6 +118,211 @@ func TestNextToken(t *testing.T) {
 		{tokens.NOT_EQ, "!="},
 		{tokens.INT, "9"},
 		{tokens.SEMICOLON, ";"},
+		{tokens.STRING, "foobar"},
+		{tokens.STRING, "foo bar"},
+		{tokens.LBRACKET, "["},
+		{tokens.INT, "1"},
+		{tokens.COMMA, ","},
+		{tokens.INT, "2"},
+		{tokens.RBRACKET, "]"},
+		{tokens.SEMICOLON, ";"},
+		{tokens.LBRACE, "{"},
+		{tokens.STRING, "foo"},
+		{tokens.COLON, ":"},
+		{tokens.STRING, "bar"},
+		{tokens.RBRACE, "}"},
+		{tokens.INT, "7"},
+		{tokens.PERCENT, "%"},
+		{tokens.INT, "3"},
+		{tokens.SEMICOLON, ";"},
+		{tokens.INT, "1"},
+		{tokens.LT_EQ, "<="},
+		{tokens.INT, "2"},
+		{tokens.GT_EQ, ">="},
+		{tokens.INT, "3"},
+		{tokens.AND, "&&"},
+		{tokens.IDENT, "x"},
+		{tokens.OR, "||"},
+		{tokens.IDENT, "y"},
+		{tokens.NULLISH, "??"},
+		{tokens.IDENT, "z"},
+		{tokens.SEMICOLON, ";"},
+		{tokens.WHILE, "while"},
+		{tokens.FOR, "for"},
+		{tokens.IN, "in"},
+		{tokens.BREAK, "break"},
+		{tokens.CONTINUE, "continue"},
+		{tokens.CONST, "const"},
+		{tokens.IDENT, "a"},
+		{tokens.PLUS_ASSIGN, "+="},
+		{tokens.IDENT, "b"},
+		{tokens.MINUS_ASSIGN, "-="},
+		{tokens.IDENT, "c"},
+		{tokens.ASTERISK_ASSIGN, "*="},
+		{tokens.IDENT, "d"},
+		{tokens.SLASH_ASSIGN, "/="},
+		{tokens.IDENT, "e"},
+		{tokens.PERCENT_ASSIGN, "%="},
+		{tokens.IDENT, "f"},
+		{tokens.SEMICOLON, ";"},
+		{tokens.EOF, ""},
+	}
+
+	var l *Lexer = New(input)
+
+	for i, tt := range tests {
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	var tests = []struct {
+		input           string
+		expectedType    tokens.TokenType
+		expectedLiteral string
+	}{
+		{`"a\nb"`, tokens.STRING, "a\nb"},
+		{`"a\tb"`, tokens.STRING, "a\tb"},
+		{`"say \"hi\""`, tokens.STRING, `say "hi"`},
+		{`"back\\slash"`, tokens.STRING, `back\slash`},
+		{`"\u{48}\u{e9}\u{1F600}"`, tokens.STRING, "H\u00e9\U0001F600"},
+		{`""`, tokens.STRING, ""},
+		{`"abc`, tokens.ILLEGAL, "unterminated string literal"},
+		{`"\q"`, tokens.ILLEGAL, `unknown escape sequence \q in string literal`},
+		{`"\u{}"`, tokens.ILLEGAL, "invalid unicode escape in string literal"},
+		{`"\u{110000}"`, tokens.ILLEGAL, "invalid unicode escape in string literal"},
+		{`"\u41"`, tokens.ILLEGAL, "invalid unicode escape in string literal"},
+		{`"größe 変数 😀"`, tokens.STRING, "größe 変数 😀"},
+		{"\"a\xffb\"", tokens.ILLEGAL, "invalid UTF-8 encoding: byte 0xff in string literal"},
+	}
+
+	for i, tt := range tests {
+		var l *Lexer = New(tt.input)
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok = l.NextToken(); tok.Type != tokens.EOF {
+			t.Fatalf("tests[%d] - expected EOF after string, got=%q", i, tok.Type)
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	var tests = []struct {
+		input           string
+		expectedType    tokens.TokenType
+		expectedLiteral string
+	}{
+		{"42", tokens.INT, "42"},
+		{"1_000_000", tokens.INT, "1_000_000"},
+		{"3.14", tokens.FLOAT, "3.14"},
+		{"0.5", tokens.FLOAT, "0.5"},
+		{"1e9", tokens.FLOAT, "1e9"},
+		{"1e-9", tokens.FLOAT, "1e-9"},
+		{"2.5E+3", tokens.FLOAT, "2.5E+3"},
+		{"1_000.000_1", tokens.FLOAT, "1_000.000_1"},
+		{"1__0", tokens.ILLEGAL, "'_' must separate successive digits in number literal"},
+		{"1_", tokens.ILLEGAL, "'_' must separate successive digits in number literal"},
+		{"1_.5", tokens.ILLEGAL, "'_' must separate successive digits in number literal"},
+		{"0xFF", tokens.INT, "0xFF"},
+		{"0Xdead_BEEF", tokens.INT, "0Xdead_BEEF"},
+		{"0o17", tokens.INT, "0o17"},
+		{"0b1010", tokens.INT, "0b1010"},
+		{"0b_1010_0101", tokens.INT, "0b_1010_0101"},
+		{"99999999999999999999", tokens.INT, "99999999999999999999"},
+		{"0x", tokens.ILLEGAL, "hexadecimal literal has no digits"},
+		{"0o_", tokens.ILLEGAL, "octal literal has no digits"},
+		{"0o78", tokens.ILLEGAL, "invalid digit '8' in octal literal"},
+		{"0b102", tokens.ILLEGAL, "invalid digit '2' in binary literal"},
+		{"0x1__F", tokens.ILLEGAL, "'_' must separate successive digits in number literal"},
+		{"0b1_", tokens.ILLEGAL, "'_' must separate successive digits in number literal"},
+	}
+
+	for i, tt := range tests {
+		var l *Lexer = New(tt.input)
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - literal wrong. expected=%q, got=%q",
+				i, tt.expectedLiteral, tok.Literal)
+		}
+
+		if tok = l.NextToken(); tok.Type != tokens.EOF {
+			t.Fatalf("tests[%d] - expected EOF after number, got=%q", i, tok.Type)
+		}
+	}
+}
+
+func TestNumberFollowedByDot(t *testing.T) {
+	var l *Lexer = New("1.e")
+
+	var expected = []tokens.TokenType{tokens.INT, tokens.ILLEGAL, tokens.IDENT, tokens.EOF}
+	for i, want := range expected {
+		if tok := l.NextToken(); tok.Type != want {
+			t.Fatalf("tokens[%d] - tokentype wrong. expected=%q, got=%q", i, want, tok.Type)
+		}
+	}
+}
+
+func TestComments(t *testing.T) {
+	const input string = `// a line comment
+let x = 5; // trailing comment
+/* a block /* with a nested */ comment */
+x / 2;
+/// Adds one.
+///Second line.
+//// not a doc comment
+fn /**/ inc(n) { n + 1 }`
+
+	var tests = []struct {
+		expectedType    tokens.TokenType
+		expectedLiteral string
+	}{
+		{tokens.LET, "let"},
+		{tokens.IDENT, "x"},
+		{tokens.ASSIGN, "="},
+		{tokens.INT, "5"},
+		{tokens.SEMICOLON, ";"},
+		{tokens.IDENT, "x"},
+		{tokens.SLASH, "/"},
+		{tokens.INT, "2"},
+		{tokens.SEMICOLON, ";"},
+		{tokens.DOC_COMMENT, "Adds one."},
+		{tokens.DOC_COMMENT, "Second line."},
+		{tokens.FUNCTION, "fn"},
+		{tokens.IDENT, "inc"},
+		{tokens.LPAREN, "("},
+		{tokens.IDENT, "n"},
+		{tokens.RPAREN, ")"},
+		{tokens.LBRACE, "{"},
+		{tokens.IDENT, "n"},
+		{tokens.PLUS, "+"},
+		{tokens.INT, "1"},
+		{tokens.RBRACE, "}"},
 		{tokens.EOF, ""},
 	}
 
@@ -125,3 +342,218 @@ func TestNextToken(t *testing.T) {
 		}
 	}
 }
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	var l *Lexer = New("let x = 1;\n  /* outer /* inner */\nlet y = 2;")
+
+	for i := 0; i < 5; i++ {
+		l.NextToken()
+	}
+
+	var tok tokens.Token = l.NextToken()
+	if tok.Type != tokens.ILLEGAL || tok.Literal != "unterminated block comment" {
+		t.Fatalf("wrong token. got=%q %q", tok.Type, tok.Literal)
+	}
+
+	if tok.Pos.String() != "2:3" {
+		t.Errorf("wrong position. want=%q, got=%q", "2:3", tok.Pos.String())
+	}
+
+	if tok = l.NextToken(); tok.Type != tokens.EOF {
+		t.Errorf("expected EOF after unterminated comment, got=%q", tok.Type)
+	}
+}
+
+func TestTokenPositions(t *testing.T) {
+	const input string = "let x = 5;\n  x + \"hi\";\n\n}"
+
+	var tests = []struct {
+		expectedType tokens.TokenType
+		expectedPos  tokens.Position
+	}{
+		{tokens.LET, tokens.Position{Filename: "test.mana", Offset: 0, Line: 1, Column: 1}},
+		{tokens.IDENT, tokens.Position{Filename: "test.mana", Offset: 4, Line: 1, Column: 5}},
+		{tokens.ASSIGN, tokens.Position{Filename: "test.mana", Offset: 6, Line: 1, Column: 7}},
+		{tokens.INT, tokens.Position{Filename: "test.mana", Offset: 8, Line: 1, Column: 9}},
+		{tokens.SEMICOLON, tokens.Position{Filename: "test.mana", Offset: 9, Line: 1, Column: 10}},
+		{tokens.IDENT, tokens.Position{Filename: "test.mana", Offset: 13, Line: 2, Column: 3}},
+		{tokens.PLUS, tokens.Position{Filename: "test.mana", Offset: 15, Line: 2, Column: 5}},
+		{tokens.STRING, tokens.Position{Filename: "test.mana", Offset: 17, Line: 2, Column: 7}},
+		{tokens.SEMICOLON, tokens.Position{Filename: "test.mana", Offset: 21, Line: 2, Column: 11}},
+		{tokens.RBRACE, tokens.Position{Filename: "test.mana", Offset: 24, Line: 4, Column: 1}},
+		{tokens.EOF, tokens.Position{Filename: "test.mana", Offset: 25, Line: 4, Column: 2}},
+	}
+
+	var l *Lexer = NewFile("test.mana", input)
+
+	for i, tt := range tests {
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestUnicodeIdentifiers(t *testing.T) {
+	const input string = "let größe = 変数 + x1 + _tmp2 + café; 2x"
+
+	var tests = []struct {
+		expectedType    tokens.TokenType
+		expectedLiteral string
+	}{
+		{tokens.LET, "let"},
+		{tokens.IDENT, "größe"},
+		{tokens.ASSIGN, "="},
+		{tokens.IDENT, "変数"},
+		{tokens.PLUS, "+"},
+		{tokens.IDENT, "x1"},
+		{tokens.PLUS, "+"},
+		{tokens.IDENT, "_tmp2"},
+		{tokens.PLUS, "+"},
+		{tokens.IDENT, "café"},
+		{tokens.SEMICOLON, ";"},
+		{tokens.INT, "2"},
+		{tokens.IDENT, "x"},
+		{tokens.EOF, ""},
+	}
+
+	var l *Lexer = New(input)
+
+	for i, tt := range tests {
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
+
+func TestUnicodePositions(t *testing.T) {
+	const input string = "\"é\" + 変数;\n€"
+
+	var tests = []struct {
+		expectedType tokens.TokenType
+		expectedPos  tokens.Position
+	}{
+		{tokens.STRING, tokens.Position{Offset: 0, Line: 1, Column: 1}},
+		{tokens.PLUS, tokens.Position{Offset: 5, Line: 1, Column: 5}},
+		{tokens.IDENT, tokens.Position{Offset: 7, Line: 1, Column: 7}},
+		{tokens.SEMICOLON, tokens.Position{Offset: 13, Line: 1, Column: 9}},
+		{tokens.ILLEGAL, tokens.Position{Offset: 15, Line: 2, Column: 1}},
+		{tokens.EOF, tokens.Position{Offset: 18, Line: 2, Column: 2}},
+	}
+
+	var l *Lexer = New(input)
+
+	for i, tt := range tests {
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType {
+			t.Fatalf("tests[%d] - tokentype wrong. expected=%q, got=%q",
+				i, tt.expectedType, tok.Type)
+		}
+
+		if tok.Pos != tt.expectedPos {
+			t.Fatalf("tests[%d] - position wrong. expected=%+v, got=%+v",
+				i, tt.expectedPos, tok.Pos)
+		}
+	}
+}
+
+func TestInvalidUTF8(t *testing.T) {
+	const input string = "x\xff\xfey \xe2\x82"
+
+	var tests = []struct {
+		expectedType    tokens.TokenType
+		expectedLiteral string
+		expectedColumn  int
+	}{
+		{tokens.IDENT, "x", 1},
+		{tokens.ILLEGAL, "invalid UTF-8 encoding: byte 0xff", 2},
+		{tokens.ILLEGAL, "invalid UTF-8 encoding: byte 0xfe", 3},
+		{tokens.IDENT, "y", 4},
+		{tokens.ILLEGAL, "invalid UTF-8 encoding: byte 0xe2", 6},
+		{tokens.ILLEGAL, "invalid UTF-8 encoding: byte 0x82", 7},
+		{tokens.EOF, "", 8},
+	}
+
+	var l *Lexer = New(input)
+
+	for i, tt := range tests {
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+
+		if tok.Pos.Column != tt.expectedColumn {
+			t.Fatalf("tests[%d] - column wrong. expected=%d, got=%d",
+				i, tt.expectedColumn, tok.Pos.Column)
+		}
+	}
+}
+
+func TestNewReader(t *testing.T) {
+	var inputs = []string{
+		"let five = 5;\nlet add = fn(x, y) { x + y; };\n",
+		"/// doc comment\r\n//// plain comment\n/* nested /* block */ */ a /= 2 // end",
+		"1_000.5e-3 + 2e+8 - 1.foo * 3e; 1__0",
+		`"tab\tquote\"" "\u{1F600}" "\u{12" "bad \q" "never closed`,
+		"let größe = 変数 + \xff\xfe; \"a\xe2\x82\"",
+		"/* unterminated",
+		strings.Repeat("let value = [1, \"två\", 3.5]; value[0] += 1;\n", 500),
+	}
+
+	for i, input := range inputs {
+		var want *Lexer = New(input)
+		var got *Lexer = NewReader(iotest.OneByteReader(strings.NewReader(input)))
+
+		for j := 0; ; j++ {
+			var expected tokens.Token = want.NextToken()
+			var tok tokens.Token = got.NextToken()
+
+			if tok != expected {
+				t.Fatalf("inputs[%d] token %d wrong. expected=%+v, got=%+v", i, j, expected, tok)
+			}
+
+			if expected.Type == tokens.EOF {
+				break
+			}
+		}
+	}
+}
+
+func TestReadError(t *testing.T) {
+	var r io.Reader = io.MultiReader(strings.NewReader("let x"), iotest.ErrReader(errors.New("disk on fire")))
+
+	var tests = []struct {
+		expectedType    tokens.TokenType
+		expectedLiteral string
+	}{
+		{tokens.LET, "let"},
+		{tokens.IDENT, "x"},
+		{tokens.ILLEGAL, "read error: disk on fire"},
+		{tokens.EOF, ""},
+		{tokens.EOF, ""},
+	}
+
+	var l *Lexer = NewReader(r)
+
+	for i, tt := range tests {
+		var tok tokens.Token = l.NextToken()
+
+		if tok.Type != tt.expectedType || tok.Literal != tt.expectedLiteral {
+			t.Fatalf("tests[%d] - token wrong. expected=%s %q, got=%s %q",
+				i, tt.expectedType, tt.expectedLiteral, tok.Type, tok.Literal)
+		}
+	}
+}
@@ -2,12 +2,72 @@ package main
 
 import (
 	"fmt"
+	"mana/ast"
+	"mana/compiler"
+	"mana/evaluator"
+	"mana/lexer"
+	"mana/object"
+	"mana/parser"
 	"mana/repl"
+	"mana/vm"
 	"os"
 	"os/user"
+	"strings"
 )
 
+const usage = `usage:
+	mana                                   start the interactive REPL
+	mana run [flags] <file.mana> [args...] run a script
+	mana [flags] <file.mana> [args...]     run a script
+
+flags:
+	-engine=E    vm    compile to bytecode and run it on the virtual machine (default)
+	             eval  walk the syntax tree
+	-overflow=O  promote  integer results too large for 64 bits become BigInts (default)
+	             error    integer results too large for 64 bits are an error
+`
+
 func main() {
+	var args []string = os.Args[1:]
+
+	if len(args) == 0 {
+		startRepl()
+		return
+	}
+
+	if args[0] == "run" {
+		args = args[1:]
+	}
+
+	var engine = "vm"
+	var overflow = "promote"
+	for len(args) > 0 && strings.HasPrefix(args[0], "-") {
+		switch {
+		case strings.HasPrefix(args[0], "-engine="):
+			engine = strings.TrimPrefix(args[0], "-engine=")
+		case strings.HasPrefix(args[0], "-overflow="):
+			overflow = strings.TrimPrefix(args[0], "-overflow=")
+		default:
+			fmt.Fprint(os.Stderr, usage)
+			os.Exit(2)
+		}
+		args = args[1:]
+	}
+
+	if len(args) == 0 || (engine != "vm" && engine != "eval") || (overflow != "promote" && overflow != "error") {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	if overflow == "error" {
+		evaluator.Overflow = evaluator.ErrorOnOverflow
+	}
+
+	os.Exit(runFile(args[0], args[1:], engine))
+}
+
+// startRepl greets the current user and starts the REPL on stdin.
+func startRepl() {
 	var user, err = user.Current()
 
 	if err != nil {
@@ -17,3 +77,85 @@ func main() {
 	fmt.Printf("Hello %s! Welcome to Mana REPL!\n", user.Username)
 	repl.Start(os.Stdin, os.Stdout)
 }
+
+// runFile parses and runs the script at path with the given engine and
+// returns the process exit status. The script sees its arguments as an array
+// of strings bound to args.
+func runFile(path string, scriptArgs []string, engine string) int {
+	file, err := os.Open(path)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "mana: %s\n", err)
+		return 1
+	}
+
+	var l *lexer.Lexer = lexer.NewFileReader(path, file)
+	var p *parser.Parser = parser.New(l)
+	var program = p.ParseProgram()
+	file.Close()
+
+	if len(p.Errors()) != 0 {
+		// The script is streamed through the lexer, so it is only read in
+		// full to show the offending lines. A pipe cannot be read again, and
+		// its errors are shown without them.
+		source, _ := os.ReadFile(path)
+		fmt.Fprint(os.Stderr, parser.RenderErrors(string(source), p.Errors()))
+		return 1
+	}
+
+	var result object.Object
+	if engine == "eval" {
+		result = evalProgram(program, scriptArgs)
+	} else {
+		result = runProgram(program, scriptArgs)
+	}
+
+	if errObj, ok := result.(*object.Error); ok {
+		fmt.Fprintln(os.Stderr, errObj.Traceback())
+		return 1
+	}
+
+	return 0
+}
+
+// evalProgram runs program on the tree-walking evaluator.
+func evalProgram(program *ast.Program, scriptArgs []string) object.Object {
+	env := object.NewEnvironment()
+	env.Set("args", scriptArguments(scriptArgs))
+
+	return evaluator.Eval(program, env)
+}
+
+// runProgram compiles program and runs it on the virtual machine. A compile or
+// runtime error is returned as an *object.Error.
+func runProgram(program *ast.Program, scriptArgs []string) object.Object {
+	symbolTable := compiler.NewSymbolTable()
+	argsSymbol := symbolTable.Define("args")
+
+	comp := compiler.NewWithState(symbolTable, []object.Object{})
+	if err := comp.Compile(program); err != nil {
+		return &object.Error{Message: err.Error()}
+	}
+
+	machine := vm.New(comp.Bytecode())
+	machine.SetGlobal(argsSymbol.Index, scriptArguments(scriptArgs))
+
+	if err := machine.Run(); err != nil {
+		if errObj, ok := err.(*object.Error); ok {
+			return errObj
+		}
+		return &object.Error{Message: err.Error()}
+	}
+
+	return machine.LastPoppedStackElem()
+}
+
+// scriptArguments converts command line arguments into a mana array.
+func scriptArguments(args []string) *object.Array {
+	elements := make([]object.Object, len(args))
+
+	for i, arg := range args {
+		elements[i] = &object.String{Value: arg}
+	}
+
+	return &object.Array{Elements: elements}
+}
@@ -0,0 +1,96 @@
+package object
+
+import (
+	"fmt"
+	"mana/ast"
+	"mana/code"
+)
+
+// CompiledFunction is a function lowered to bytecode by the compiler. It only
+// lives in the constant pool; at runtime functions are represented by
+// Closures.
+type CompiledFunction struct {
+	Instructions  code.Instructions
+	Positions     code.PositionTable
+	NumLocals     int
+	NumParameters int
+	Name          string
+
+	// LocalNames holds the name of each local slot, for error messages.
+	LocalNames []string
+	// Free describes where each free variable is captured from when a
+	// Closure over this function is created.
+	Free []FreeVariable
+
+	// LocalFallbacks maps a local slot to the free variable that is read or
+	// assigned instead while the slot is unset, because the name is bound
+	// in an enclosing function; the evaluator finds it there too. A slot
+	// without an entry falls back to the global or builtin of its name.
+	LocalFallbacks map[int]int
+	// FreeFallbacks does the same for the free variables.
+	FreeFallbacks map[int]int
+
+	// Parameters and Body are the source of the function. They are kept so
+	// that a Closure inspects exactly like the evaluator's Function.
+	Parameters []*ast.Identifier
+	Body       *ast.BlockStatement
+}
+
+// FreeVariable says where a closure captures one of its free variables from:
+// a local slot of the enclosing function's frame, or one of the enclosing
+// closure's own free variables.
+type FreeVariable struct {
+	Name    string
+	IsLocal bool
+	Index   int
+}
+
+func (cf *CompiledFunction) Type() ObjectType { return COMPILED_FUNCTION_OBJ }
+func (cf *CompiledFunction) Inspect() string {
+	return fmt.Sprintf("CompiledFunction[%p]", cf)
+}
+
+// Upvalue is a variable captured by a Closure. While the frame that owns the
+// variable is still running, the upvalue is open and refers to the variable's
+// stack slot; when the frame returns, the value is copied into the upvalue and
+// it is closed. Closures share upvalues, so they all see assignments to the
+// variable, just like closures in the evaluator share an Environment.
+type Upvalue struct {
+	Slot  int    // stack slot while open, -1 once closed
+	Value Object // the captured value once closed
+}
+
+// IsOpen reports whether the upvalue still refers to a stack slot.
+func (u *Upvalue) IsOpen() bool {
+	return u.Slot >= 0
+}
+
+// Close detaches the upvalue from the stack, keeping value.
+func (u *Upvalue) Close(value Object) {
+	u.Value = value
+	u.Slot = -1
+}
+
+// Closure is a CompiledFunction together with the variables it captured. It
+// is the bytecode counterpart of Function and reports the same type.
+type Closure struct {
+	Fn   *CompiledFunction
+	Free []*Upvalue
+}
+
+func (c *Closure) Type() ObjectType { return FUNCTION_OBJ }
+func (c *Closure) Inspect() string {
+	return inspectFunction(c.Fn.Parameters, c.Fn.Body)
+}
+
+// Iterator holds the state of a for-in loop in the VM. It stays on the stack
+// while the loop runs.
+type Iterator struct {
+	Values []Object
+	Next   int // index of the next value to visit
+}
+
+func (it *Iterator) Type() ObjectType { return ITERATOR_OBJ }
+func (it *Iterator) Inspect() string {
+	return fmt.Sprintf("Iterator[%d/%d]", it.Next, len(it.Values))
+}
@@ -1,20 +1,95 @@
 package object
 
+import "sort"
+
+// NewEnvironment returns a new, empty top-level Environment.
 func NewEnvironment() *Environment {
-	s := make(map[string]Object)
-	return &Environment{store: s}
+	s := make(map[string]binding)
+	return &Environment{store: s, outer: nil}
+}
+
+// NewEnclosedEnvironment returns a new Environment that wraps the given outer
+// Environment. Lookups that miss in the new Environment fall through to outer.
+func NewEnclosedEnvironment(outer *Environment) *Environment {
+	env := NewEnvironment()
+	env.outer = outer
+	env.depth = outer.depth
+	return env
+}
+
+// NewCallEnvironment returns the Environment of a function call, which wraps
+// the Environment the function was defined in. depth is the number of calls
+// that are active with this one, as reported by Depth.
+func NewCallEnvironment(outer *Environment, depth int) *Environment {
+	env := NewEnclosedEnvironment(outer)
+	env.depth = depth
+	return env
 }
 
 type Environment struct {
-	store map[string]Object
+	store map[string]binding
+	outer *Environment
+	depth int // number of active function calls, 0 at the top level
+}
+
+// Depth returns the number of function calls that are active while code runs
+// in this Environment.
+func (e *Environment) Depth() int {
+	return e.depth
+}
+
+// binding is a value bound to a name, and whether it was bound by const.
+type binding struct {
+	value    Object
+	constant bool
 }
 
+// Get looks up a name in the Environment, walking the chain of enclosing
+// environments until it is found.
 func (e *Environment) Get(name string) (Object, bool) {
-	obj, ok := e.store[name]
-	return obj, ok
+	b, ok := e.store[name]
+	if !ok && e.outer != nil {
+		return e.outer.Get(name)
+	}
+	return b.value, ok
 }
 
+// Set binds a name to a value in this Environment, declaring it if it is not
+// bound here yet.
 func (e *Environment) Set(name string, val Object) Object {
-	e.store[name] = val
+	e.store[name] = binding{value: val}
 	return val
 }
+
+// SetConst binds a name to a value in this Environment as a constant.
+func (e *Environment) SetConst(name string, val Object) Object {
+	e.store[name] = binding{value: val, constant: true}
+	return val
+}
+
+// IsConstant reports whether name is bound to a constant in this Environment.
+// Enclosing environments are not consulted.
+func (e *Environment) IsConstant(name string) bool {
+	return e.store[name].constant
+}
+
+// Names returns the names bound in this Environment, without those of
+// enclosing ones, in sorted order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.store))
+	for name := range e.store {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the nearest Environment of the chain that binds name.
+func (e *Environment) Resolve(name string) (*Environment, bool) {
+	for env := e; env != nil; env = env.outer {
+		if _, ok := env.store[name]; ok {
+			return env, true
+		}
+	}
+	return nil, false
+}
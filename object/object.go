@@ -4,18 +4,34 @@ import (
 	"bytes"
 	"fmt"
 	"mana/ast"
+	"mana/tokens"
+	"math"
+	"math/big"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 type ObjectType string
 
 const (
 	INTEGER_OBJ      = "INTEGER"
+	BIGINT_OBJ       = "BIGINT"
+	FLOAT_OBJ        = "FLOAT"
+	STRING_OBJ       = "STRING"
 	BOOLEAN_OBJ      = "BOOLEAN"
 	NULL_OBJ         = "NULL"
 	RETURN_VALUE_OBJ = "RETURN_VALUE"
+	BREAK_OBJ        = "BREAK"
+	CONTINUE_OBJ     = "CONTINUE"
 	FUNCTION_OBJ     = "FUNCTION"
 	ERROR_OBJ        = "ERROR"
+	ARRAY_OBJ        = "ARRAY"
+	HASH_OBJ         = "HASH"
+	BUILTIN_OBJ      = "BUILTIN"
+
+	COMPILED_FUNCTION_OBJ = "COMPILED_FUNCTION"
+	ITERATOR_OBJ          = "ITERATOR"
 )
 
 type Object interface {
@@ -27,6 +43,21 @@ type Integer struct {
 	Value int64
 }
 
+// BigInt is an integer outside the range of an int64. Integer operations
+// return an Integer whenever their result fits in one, so the two types never
+// hold the same value.
+type BigInt struct {
+	Value *big.Int
+}
+
+type Float struct {
+	Value float64
+}
+
+type String struct {
+	Value string
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -37,11 +68,40 @@ type ReturnValue struct {
 	Value Object
 }
 
+// Break and Continue signal a break or continue statement to the enclosing
+// loop. Like ReturnValue, they are never seen by mana programs.
+type Break struct{}
+
+type Continue struct{}
+
 type Error struct {
 	Message string
+	Pos     tokens.Position // where in the source the error was raised
+	// Frames holds the calls of mana functions that were active when the
+	// error was raised, the innermost call first.
+	Frames []Frame
+}
+
+// Frame is a call of a mana function on the way to a runtime error.
+type Frame struct {
+	Function string          // name of the function, or <anonymous>
+	Pos      tokens.Position // where the function was called
+	Args     string          // summary of the arguments of the call
+}
+
+// BuiltinFunction is the signature of a Go function callable from mana.
+type BuiltinFunction func(args ...Object) Object
+
+type Builtin struct {
+	Fn BuiltinFunction
+}
+
+type Array struct {
+	Elements []Object
 }
 
 type Function struct {
+	Name       string // name the function was declared with, if any
 	Parameters []*ast.Identifier
 	Body       *ast.BlockStatement
 	Env        *Environment
@@ -55,6 +115,61 @@ func (i *Integer) Inspect() string {
 	return fmt.Sprintf("%d", i.Value)
 }
 
+// IntegerFromBig returns v as an Integer if it fits in an int64, and as a
+// BigInt otherwise.
+func IntegerFromBig(v *big.Int) Object {
+	if v.IsInt64() {
+		return &Integer{Value: v.Int64()}
+	}
+	return &BigInt{Value: v}
+}
+
+func (b *BigInt) Type() ObjectType {
+	return BIGINT_OBJ
+}
+
+func (b *BigInt) Inspect() string {
+	return b.Value.String()
+}
+
+func (f *Float) Type() ObjectType {
+	return FLOAT_OBJ
+}
+
+// Inspect formats the float so that it never reads as an integer: whole
+// values keep a ".0", very large and very small values use an exponent, and
+// the IEEE special values print as Inf, -Inf and NaN.
+func (f *Float) Inspect() string {
+	switch {
+	case math.IsInf(f.Value, 1):
+		return "Inf"
+	case math.IsInf(f.Value, -1):
+		return "-Inf"
+	case math.IsNaN(f.Value):
+		return "NaN"
+	}
+
+	var format byte = 'f'
+	if abs := math.Abs(f.Value); abs >= 1e21 || (abs != 0 && abs < 1e-6) {
+		format = 'e'
+	}
+
+	s := strconv.FormatFloat(f.Value, format, -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+
+	return s
+}
+
+func (s *String) Type() ObjectType {
+	return STRING_OBJ
+}
+
+func (s *String) Inspect() string {
+	return s.Value
+}
+
 func (b *Boolean) Type() ObjectType {
 	return BOOLEAN_OBJ
 }
@@ -79,16 +194,37 @@ func (rv *ReturnValue) Inspect() string {
 	return rv.Value.Inspect()
 }
 
+func (b *Break) Type() ObjectType {
+	return BREAK_OBJ
+}
+
+func (b *Break) Inspect() string {
+	return "break"
+}
+
+func (c *Continue) Type() ObjectType {
+	return CONTINUE_OBJ
+}
+
+func (c *Continue) Inspect() string {
+	return "continue"
+}
+
 func (f *Function) Type() ObjectType {
 	return FUNCTION_OBJ
 }
 
 func (f *Function) Inspect() string {
+	return inspectFunction(f.Parameters, f.Body)
+}
+
+// inspectFunction renders a function from its source parameters and body.
+func inspectFunction(parameters []*ast.Identifier, body *ast.BlockStatement) string {
 	var out bytes.Buffer
 
 	params := []string{}
 
-	for _, p := range f.Parameters {
+	for _, p := range parameters {
 		params = append(params, p.String())
 	}
 
@@ -96,11 +232,256 @@ func (f *Function) Inspect() string {
 	out.WriteString("(")
 	out.WriteString(strings.Join(params, ", "))
 	out.WriteString(") {\n")
-	out.WriteString(f.Body.String())
+	out.WriteString(body.String())
 	out.WriteString("\n}")
 
 	return out.String()
 }
 
+// Error implements the error interface, so that backends which report runtime
+// errors as Go errors can return an *Error directly.
+func (e *Error) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
+	return e.Message
+}
+
 func (e *Error) Type() ObjectType { return ERROR_OBJ }
-func (e *Error) Inspect() string  { return "ERROR:" + e.Message }
+func (e *Error) Inspect() string {
+	if e.Pos.IsValid() {
+		return "ERROR: " + e.Pos.String() + ": " + e.Message
+	}
+	return "ERROR: " + e.Message
+}
+
+// maxRepeatedFrames is the number of consecutive frames of the same call a
+// traceback shows before it summarizes the rest, as deep recursion produces.
+const maxRepeatedFrames = 3
+
+// Traceback renders the error in the style of a Python traceback: the calls
+// that led to it, outermost first, followed by the message. An error raised
+// outside of any function renders like Inspect.
+func (e *Error) Traceback() string {
+	if len(e.Frames) == 0 {
+		return e.Inspect()
+	}
+
+	var out strings.Builder
+	out.WriteString("Traceback (most recent call last):\n")
+
+	// The call of each function happened inside the function of the next
+	// frame out, and the error itself inside the innermost function. Lines
+	// count as repeated when they are in the same function at the same
+	// position, whatever its arguments, as in a recursion like f(n + 1).
+	var function, args string = "<main>", ""
+	var previous string
+	var repeated int
+	for i := len(e.Frames); i >= 0; i-- {
+		var pos tokens.Position = e.Pos
+		if i > 0 {
+			pos = e.Frames[i-1].Pos
+		}
+
+		var line string = tracebackLine(pos, function)
+		if line == previous {
+			repeated++
+		} else {
+			writeRepeated(&out, repeated)
+			previous, repeated = line, 0
+		}
+		if repeated < maxRepeatedFrames {
+			out.WriteString(tracebackLine(pos, function+args))
+		}
+
+		if i > 0 {
+			function, args = e.Frames[i-1].Function, "("+e.Frames[i-1].Args+")"
+		}
+	}
+	writeRepeated(&out, repeated)
+
+	out.WriteString("ERROR: " + e.Message)
+	return out.String()
+}
+
+// tracebackLine renders one line of a traceback: a position inside function.
+func tracebackLine(pos tokens.Position, function string) string {
+	var filename string = pos.Filename
+	if filename == "" {
+		filename = "<input>"
+	}
+	return fmt.Sprintf("  File %q, line %d, column %d, in %s\n", filename, pos.Line, pos.Column, function)
+}
+
+// writeRepeated notes how many lines of a traceback were left out because
+// they repeat the line before them.
+func writeRepeated(out *strings.Builder, repeated int) {
+	if repeated >= maxRepeatedFrames {
+		fmt.Fprintf(out, "  [Previous line repeated %d more times]\n", repeated-maxRepeatedFrames+1)
+	}
+}
+
+// maxArgLength is the number of characters of each argument a Frame keeps.
+const maxArgLength = 20
+
+// ArgsSummary summarizes the arguments of a call for a Frame. Each argument
+// is written as in source and shortened if it is long.
+func ArgsSummary(args []Object) string {
+	var summary []string = make([]string, len(args))
+
+	for i, arg := range args {
+		var text []rune = []rune(inspectElement(arg))
+		if len(text) > maxArgLength {
+			text = append(text[:maxArgLength-3], []rune("...")...)
+		}
+		summary[i] = string(text)
+	}
+
+	return strings.Join(summary, ", ")
+}
+
+func (b *Builtin) Type() ObjectType { return BUILTIN_OBJ }
+func (b *Builtin) Inspect() string  { return "builtin function" }
+
+func (a *Array) Type() ObjectType { return ARRAY_OBJ }
+func (a *Array) Inspect() string {
+	var out bytes.Buffer
+
+	elements := []string{}
+
+	for _, e := range a.Elements {
+		elements = append(elements, inspectElement(e))
+	}
+
+	out.WriteString("[")
+	out.WriteString(strings.Join(elements, ", "))
+	out.WriteString("]")
+
+	return out.String()
+}
+
+// inspectElement renders an object nested inside a container the way it would
+// be written in source, so strings come out quoted.
+func inspectElement(obj Object) string {
+	if s, ok := obj.(*String); ok {
+		return quoteString(s.Value)
+	}
+	return obj.Inspect()
+}
+
+// quoteString renders s as a double-quoted mana string literal, escaping
+// characters the lexer would otherwise not read back verbatim.
+func quoteString(s string) string {
+	var out strings.Builder
+
+	out.WriteByte('"')
+	for _, r := range s {
+		switch r {
+		case '"':
+			out.WriteString(`\"`)
+		case '\\':
+			out.WriteString(`\\`)
+		case '\n':
+			out.WriteString(`\n`)
+		case '\t':
+			out.WriteString(`\t`)
+		case '\r':
+			out.WriteString(`\r`)
+		default:
+			if unicode.IsPrint(r) {
+				out.WriteRune(r)
+			} else {
+				fmt.Fprintf(&out, "\\u{%x}", r)
+			}
+		}
+	}
+	out.WriteByte('"')
+
+	return out.String()
+}
+
+// HashKey is the key under which a Hashable object is stored in a Hash. Two
+// objects have the same HashKey exactly if they are equal.
+type HashKey struct {
+	Type  ObjectType
+	Value uint64
+	Text  string // the whole value of keys that do not fit in Value
+}
+
+// Hashable is implemented by objects that can be used as hash keys.
+type Hashable interface {
+	HashKey() HashKey
+}
+
+func (b *Boolean) HashKey() HashKey {
+	var value uint64
+
+	if b.Value {
+		value = 1
+	} else {
+		value = 0
+	}
+
+	return HashKey{Type: b.Type(), Value: value}
+}
+
+func (i *Integer) HashKey() HashKey {
+	return HashKey{Type: i.Type(), Value: uint64(i.Value)}
+}
+
+// HashKey keys a big integer by its decimal text, which, like the text of a
+// string, cannot collide with that of a different value.
+func (b *BigInt) HashKey() HashKey {
+	return HashKey{Type: b.Type(), Text: b.Value.String()}
+}
+
+// HashKey keys a string by its text rather than a hash of it, so that two
+// different strings can never collide.
+func (s *String) HashKey() HashKey {
+	return HashKey{Type: s.Type(), Text: s.Value}
+}
+
+// HashPair holds the original key object alongside its value, so a Hash can
+// be inspected and iterated without reversing HashKeys.
+type HashPair struct {
+	Key   Object
+	Value Object
+}
+
+// Hash is a mapping from hashable keys to values. Keys remembers insertion
+// order so that Inspect and iteration are deterministic.
+type Hash struct {
+	Pairs map[HashKey]HashPair
+	Keys  []HashKey
+}
+
+// NewHash returns a new, empty Hash.
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]HashPair)}
+}
+
+// Set stores pair under key, keeping the position of an existing key.
+func (h *Hash) Set(key HashKey, pair HashPair) {
+	if _, ok := h.Pairs[key]; !ok {
+		h.Keys = append(h.Keys, key)
+	}
+	h.Pairs[key] = pair
+}
+
+func (h *Hash) Type() ObjectType { return HASH_OBJ }
+func (h *Hash) Inspect() string {
+	var out bytes.Buffer
+
+	pairs := []string{}
+
+	for _, key := range h.Keys {
+		pair := h.Pairs[key]
+		pairs = append(pairs, inspectElement(pair.Key)+": "+inspectElement(pair.Value))
+	}
+
+	out.WriteString("{")
+	out.WriteString(strings.Join(pairs, ", "))
+	out.WriteString("}")
+
+	return out.String()
+}
@@ -0,0 +1,189 @@
+package object
+
+import (
+	"fmt"
+	"mana/tokens"
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestStringHashKey(t *testing.T) {
+	hello1 := &String{Value: "Hello World"}
+	hello2 := &String{Value: "Hello World"}
+	diff1 := &String{Value: "My name is johnny"}
+	diff2 := &String{Value: "My name is johnny"}
+
+	if hello1.HashKey() != hello2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if diff1.HashKey() != diff2.HashKey() {
+		t.Errorf("strings with same content have different hash keys")
+	}
+
+	if hello1.HashKey() == diff1.HashKey() {
+		t.Errorf("strings with different content have same hash keys")
+	}
+}
+
+func TestFloatInspect(t *testing.T) {
+	tests := []struct {
+		value    float64
+		expected string
+	}{
+		{3.14, "3.14"},
+		{2, "2.0"},
+		{-0.5, "-0.5"},
+		{1e21, "1e+21"},
+		{1e-7, "1e-07"},
+		{123456789, "123456789.0"},
+		{math.Inf(1), "Inf"},
+		{math.Inf(-1), "-Inf"},
+		{math.NaN(), "NaN"},
+	}
+
+	for _, tt := range tests {
+		if got := (&Float{Value: tt.value}).Inspect(); got != tt.expected {
+			t.Errorf("Inspect of %g wrong. want=%q, got=%q", tt.value, tt.expected, got)
+		}
+	}
+}
+
+func TestStringHashKeysDoNotCollide(t *testing.T) {
+	// These two strings have the same 64-bit FNV-1a hash.
+	a := &String{Value: "8yn0iYCKYHlIj4-BwPqk"}
+	b := &String{Value: "GReLUrM4wMqfg9yzV3KQ"}
+
+	if a.HashKey() == b.HashKey() {
+		t.Fatalf("different strings have the same hash key")
+	}
+
+	hash := NewHash()
+	hash.Set(a.HashKey(), HashPair{Key: a, Value: &Integer{Value: 1}})
+	hash.Set(b.HashKey(), HashPair{Key: b, Value: &Integer{Value: 2}})
+
+	if len(hash.Pairs) != 2 {
+		t.Errorf("hash has wrong number of pairs. want=2, got=%d", len(hash.Pairs))
+	}
+}
+
+func TestBigIntHashKey(t *testing.T) {
+	big1, _ := new(big.Int).SetString("99999999999999999999", 10)
+	big2, _ := new(big.Int).SetString("99999999999999999999", 10)
+	negative := new(big.Int).Neg(big1)
+
+	if (&BigInt{Value: big1}).HashKey() != (&BigInt{Value: big2}).HashKey() {
+		t.Errorf("big integers with same value have different hash keys")
+	}
+
+	if (&BigInt{Value: big1}).HashKey() == (&BigInt{Value: negative}).HashKey() {
+		t.Errorf("big integers with opposite signs have same hash keys")
+	}
+
+	hash := NewHash()
+	for i := int64(0); i < 1000; i++ {
+		key := &BigInt{Value: new(big.Int).Add(big1, big.NewInt(i))}
+		hash.Set(key.HashKey(), HashPair{Key: key, Value: &Integer{Value: i}})
+	}
+	if len(hash.Pairs) != 1000 {
+		t.Errorf("distinct big integers share hash keys. want=1000 pairs, got=%d", len(hash.Pairs))
+	}
+}
+
+func TestIntegerFromBig(t *testing.T) {
+	if _, ok := IntegerFromBig(big.NewInt(-42)).(*Integer); !ok {
+		t.Errorf("IntegerFromBig(-42) is not an Integer")
+	}
+
+	var large *big.Int = new(big.Int).Lsh(big.NewInt(1), 63)
+	if _, ok := IntegerFromBig(large).(*BigInt); !ok {
+		t.Errorf("IntegerFromBig(2^63) is not a BigInt")
+	}
+}
+
+func TestTraceback(t *testing.T) {
+	err := &Error{
+		Message: "division by zero: 1 / 0",
+		Pos:     tokens.Position{Filename: "main.mana", Line: 2, Column: 7},
+		Frames: []Frame{
+			{Function: "divide", Pos: tokens.Position{Filename: "main.mana", Line: 5, Column: 11}, Args: "1, 0"},
+			{Function: "<anonymous>", Pos: tokens.Position{Filename: "main.mana", Line: 8, Column: 2}, Args: ""},
+		},
+	}
+
+	expected := `Traceback (most recent call last):
+  File "main.mana", line 8, column 2, in <main>
+  File "main.mana", line 5, column 11, in <anonymous>()
+  File "main.mana", line 2, column 7, in divide(1, 0)
+ERROR: division by zero: 1 / 0`
+
+	if got := err.Traceback(); got != expected {
+		t.Errorf("Traceback wrong.\nwant=%s\ngot=%s", expected, got)
+	}
+
+	err.Frames = nil
+	if got := err.Traceback(); got != err.Inspect() {
+		t.Errorf("Traceback without frames wrong. want=%q, got=%q", err.Inspect(), got)
+	}
+}
+
+func TestTracebackRepeatedFrames(t *testing.T) {
+	var recursive = Frame{Function: "f", Pos: tokens.Position{Line: 1, Column: 12}, Args: ""}
+	err := &Error{Message: "stack overflow", Pos: tokens.Position{Line: 1, Column: 12}}
+	for i := 0; i < 10; i++ {
+		err.Frames = append(err.Frames, recursive)
+	}
+	err.Frames = append(err.Frames, Frame{Function: "f", Pos: tokens.Position{Line: 2, Column: 2}})
+
+	expected := `Traceback (most recent call last):
+  File "<input>", line 2, column 2, in <main>
+  File "<input>", line 1, column 12, in f()
+  File "<input>", line 1, column 12, in f()
+  File "<input>", line 1, column 12, in f()
+  [Previous line repeated 8 more times]
+ERROR: stack overflow`
+
+	if got := err.Traceback(); got != expected {
+		t.Errorf("Traceback wrong.\nwant=%s\ngot=%s", expected, got)
+	}
+
+	// Frames of the same call count as repeated even if their arguments
+	// differ.
+	for i := range err.Frames[:10] {
+		err.Frames[i].Args = fmt.Sprint(10 - i)
+	}
+	err.Frames[10].Args = "0"
+
+	expected = `Traceback (most recent call last):
+  File "<input>", line 2, column 2, in <main>
+  File "<input>", line 1, column 12, in f(0)
+  File "<input>", line 1, column 12, in f(1)
+  File "<input>", line 1, column 12, in f(2)
+  [Previous line repeated 8 more times]
+ERROR: stack overflow`
+
+	if got := err.Traceback(); got != expected {
+		t.Errorf("Traceback wrong.\nwant=%s\ngot=%s", expected, got)
+	}
+}
+
+func TestArgsSummary(t *testing.T) {
+	args := []Object{
+		&Integer{Value: 1},
+		&String{Value: "two"},
+		&Array{Elements: []Object{&Integer{Value: 3}}},
+		&String{Value: "a string that is far too long"},
+	}
+
+	expected := `1, "two", [3], "a string that is...`
+	if got := ArgsSummary(args); got != expected {
+		t.Errorf("ArgsSummary wrong. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestHashKeyTypesDiffer(t *testing.T) {
+	if (&Integer{Value: 1}).HashKey() == (&Boolean{Value: true}).HashKey() {
+		t.Errorf("integer 1 and true have the same hash key")
+	}
+}
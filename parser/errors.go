@@ -0,0 +1,118 @@
+package parser
+
+import (
+	"fmt"
+	"mana/tokens"
+	"strconv"
+	"strings"
+)
+
+// Error is a syntax error found while parsing. Expected is empty when the
+// parser was not looking for one particular token.
+type Error struct {
+	Pos      tokens.Position  // where the offending token starts
+	Expected tokens.TokenType // the token type the parser wanted, if any
+	Actual   tokens.TokenType // the token type the parser found
+	Message  string
+}
+
+// Error returns the error message prefixed with its position, e.g.
+// "main.mana:2:9: expected next token to be ), got ; instead".
+func (e *Error) Error() string {
+	return e.Pos.String() + ": " + e.Message
+}
+
+// Render formats the error with the offending line of source and a caret
+// under the column the error points at:
+//
+//	error: expected next token to be ), got ; instead
+//	 --> main.mana:2:9
+//	  |
+//	2 | add(1, 2;
+//	  |         ^
+//
+// source must be the full text the parser was given. If the position does not
+// fall inside source, only the message and location are rendered.
+func (e *Error) Render(source string) string {
+	var out strings.Builder
+
+	out.WriteString("error: " + e.Message + "\n")
+
+	line, ok := sourceLine(source, e.Pos)
+	if !ok {
+		out.WriteString(" --> " + e.Pos.String() + "\n")
+		return out.String()
+	}
+
+	var lineNumber string = strconv.Itoa(e.Pos.Line)
+	var gutter string = strings.Repeat(" ", len(lineNumber))
+
+	out.WriteString(gutter + "--> " + e.Pos.String() + "\n")
+	out.WriteString(gutter + " |\n")
+	out.WriteString(lineNumber + " | " + line + "\n")
+	out.WriteString(gutter + " | " + caretIndent(line, e.Pos.Column) + "^\n")
+
+	return out.String()
+}
+
+// RenderErrors renders every error in errs, separated by blank lines.
+func RenderErrors(source string, errs []*Error) string {
+	rendered := make([]string, len(errs))
+
+	for i, err := range errs {
+		rendered[i] = err.Render(source)
+	}
+
+	return strings.Join(rendered, "\n")
+}
+
+// sourceLine returns the text of the line pos points into, without its line
+// terminator.
+func sourceLine(source string, pos tokens.Position) (string, bool) {
+	if !pos.IsValid() || pos.Offset < 0 || pos.Offset > len(source) {
+		return "", false
+	}
+
+	var start int = strings.LastIndexByte(source[:pos.Offset], '\n') + 1
+	var end int = strings.IndexByte(source[pos.Offset:], '\n')
+
+	if end < 0 {
+		end = len(source)
+	} else {
+		end += pos.Offset
+	}
+
+	return strings.TrimSuffix(source[start:end], "\r"), true
+}
+
+// caretIndent returns the whitespace that lines a caret up under the given
+// column of line, counted in runes. Tabs in line are kept so the caret stays
+// aligned however wide the terminal renders them.
+func caretIndent(line string, column int) string {
+	var indent strings.Builder
+	var runes []rune = []rune(line)
+
+	for i := 0; i < column-1 && i < len(runes); i++ {
+		if runes[i] == '\t' {
+			indent.WriteByte('\t')
+		} else {
+			indent.WriteByte(' ')
+		}
+	}
+
+	for i := len(runes); i < column-1; i++ {
+		indent.WriteByte(' ')
+	}
+
+	return indent.String()
+}
+
+// newError returns an Error at pos with a formatted message.
+func newError(pos tokens.Position, expected, actual tokens.TokenType, format string, a ...interface{}) *Error {
+	return &Error{
+		Pos:      pos,
+		Expected: expected,
+		Actual:   actual,
+		Message:  fmt.Sprintf(format, a...),
+	}
+}
@@ -1,35 +1,54 @@
 package parser
 
 import (
-	"fmt"
+	"errors"
 	"mana/ast"
-	"mana/lexer"
 	"mana/tokens"
+	"math/big"
 	"strconv"
+	"strings"
 )
 
 // Define the precedence of the operators.
 const (
 	_ int = iota
 	LOWEST
+	ASSIGN      // =, += and the other assignment operators
+	NULLISH     // ??
+	OR          // ||
+	AND         // &&
 	EQUALS      // ==
-	LESSGREATER // > or <
+	LESSGREATER // >, <, >= or <=
 	SUM         // +
-	PRODUCT     // *
+	PRODUCT     // *, / or %
 	PREFIX      // -X or !X
 	CALL        // myFunction(X)
+	INDEX       // array[index]
 )
 
 var precedences = map[tokens.TokenType]int{
-	tokens.EQ:       EQUALS,
-	tokens.NOT_EQ:   EQUALS,
-	tokens.LT:       LESSGREATER,
-	tokens.GT:       LESSGREATER,
-	tokens.PLUS:     SUM,
-	tokens.MINUS:    SUM,
-	tokens.SLASH:    PRODUCT,
-	tokens.ASTERISK: PRODUCT,
-	tokens.LPAREN:   CALL,
+	tokens.ASSIGN:          ASSIGN,
+	tokens.PLUS_ASSIGN:     ASSIGN,
+	tokens.MINUS_ASSIGN:    ASSIGN,
+	tokens.ASTERISK_ASSIGN: ASSIGN,
+	tokens.SLASH_ASSIGN:    ASSIGN,
+	tokens.PERCENT_ASSIGN:  ASSIGN,
+	tokens.EQ:              EQUALS,
+	tokens.NOT_EQ:          EQUALS,
+	tokens.LT:              LESSGREATER,
+	tokens.GT:              LESSGREATER,
+	tokens.LT_EQ:           LESSGREATER,
+	tokens.GT_EQ:           LESSGREATER,
+	tokens.AND:             AND,
+	tokens.OR:              OR,
+	tokens.NULLISH:         NULLISH,
+	tokens.PLUS:            SUM,
+	tokens.MINUS:           SUM,
+	tokens.SLASH:           PRODUCT,
+	tokens.ASTERISK:        PRODUCT,
+	tokens.PERCENT:         PRODUCT,
+	tokens.LPAREN:          CALL,
+	tokens.LBRACKET:        INDEX,
 }
 
 type (
@@ -37,23 +56,47 @@ type (
 	infixParseFn  func(ast.Expression) ast.Expression
 )
 
+// TokenSource is anything the parser can read tokens from, such as a
+// *lexer.Lexer. Once it has returned an EOF token, it must keep returning EOF.
+type TokenSource interface {
+	NextToken() tokens.Token
+}
+
 // Parser represents a parser.
 type Parser struct {
-	l      *lexer.Lexer
-	errors []string
+	l      TokenSource
+	errors []*Error
 
 	curToken  tokens.Token
 	peekToken tokens.Token
 
+	// curDoc and peekDoc hold the doc comments directly in front of
+	// curToken and peekToken.
+	curDoc  string
+	peekDoc string
+
+	// depth is the number of '{' before curToken that are not yet closed.
+	depth int
+	// loops is the number of loops around curToken within the current
+	// function, to reject break and continue outside of a loop.
+	loops int
+	// panicking is set by the first error in a statement and suppresses
+	// further errors until the parser has resynchronized.
+	panicking bool
+	// scopes holds the names declared so far at the top level and in each
+	// function around curToken, mapped to whether they are constants.
+	scopes []map[string]bool
+
 	prefixParseFns map[tokens.TokenType]prefixParseFn
 	infixParseFns  map[tokens.TokenType]infixParseFn
 }
 
-// New returns a new Parser.
-func New(l *lexer.Lexer) *Parser {
+// New returns a new Parser that reads its tokens from l.
+func New(l TokenSource) *Parser {
 	var p *Parser = &Parser{
 		l:      l,
-		errors: []string{},
+		errors: []*Error{},
+		scopes: []map[string]bool{{}},
 	}
 
 	// Read two tokens, so curToken and peekToken are both set.
@@ -64,6 +107,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.prefixParseFns = make(map[tokens.TokenType]prefixParseFn)
 	p.registerPrefix(tokens.IDENT, p.parseIdentifier)
 	p.registerPrefix(tokens.INT, p.parseIntegerLiteral)
+	p.registerPrefix(tokens.FLOAT, p.parseFloatLiteral)
+	p.registerPrefix(tokens.STRING, p.parseStringLiteral)
 	p.registerPrefix(tokens.BANG, p.parsePrefixExpression)
 	p.registerPrefix(tokens.MINUS, p.parsePrefixExpression)
 	p.registerPrefix(tokens.TRUE, p.parseBoolean)
@@ -71,6 +116,8 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerPrefix(tokens.IF, p.parseIfExpression)
 	p.registerPrefix(tokens.FUNCTION, p.parseFunctionLiteral)
 	p.registerPrefix(tokens.LPAREN, p.parseGroupedExpression)
+	p.registerPrefix(tokens.LBRACKET, p.parseArrayLiteral)
+	p.registerPrefix(tokens.LBRACE, p.parseHashLiteral)
 
 	// Initialize the infix parse functions.
 	p.infixParseFns = make(map[tokens.TokenType]infixParseFn)
@@ -78,19 +125,51 @@ func New(l *lexer.Lexer) *Parser {
 	p.registerInfix(tokens.MINUS, p.parseInfixExpression)
 	p.registerInfix(tokens.SLASH, p.parseInfixExpression)
 	p.registerInfix(tokens.ASTERISK, p.parseInfixExpression)
+	p.registerInfix(tokens.PERCENT, p.parseInfixExpression)
 	p.registerInfix(tokens.EQ, p.parseInfixExpression)
 	p.registerInfix(tokens.NOT_EQ, p.parseInfixExpression)
 	p.registerInfix(tokens.LT, p.parseInfixExpression)
 	p.registerInfix(tokens.GT, p.parseInfixExpression)
+	p.registerInfix(tokens.LT_EQ, p.parseInfixExpression)
+	p.registerInfix(tokens.GT_EQ, p.parseInfixExpression)
+	p.registerInfix(tokens.AND, p.parseInfixExpression)
+	p.registerInfix(tokens.OR, p.parseInfixExpression)
+	p.registerInfix(tokens.NULLISH, p.parseInfixExpression)
+	p.registerInfix(tokens.ASSIGN, p.parseAssignExpression)
+	p.registerInfix(tokens.PLUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(tokens.MINUS_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(tokens.ASTERISK_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(tokens.SLASH_ASSIGN, p.parseAssignExpression)
+	p.registerInfix(tokens.PERCENT_ASSIGN, p.parseAssignExpression)
 	p.registerInfix(tokens.LPAREN, p.parseCallExpression)
+	p.registerInfix(tokens.LBRACKET, p.parseIndexExpression)
 
 	return p
 }
 
 // nextToken advances the tokens.
 func (p *Parser) nextToken() {
+	switch p.curToken.Type {
+	case tokens.LBRACE:
+		p.depth++
+	case tokens.RBRACE:
+		p.depth--
+	}
+
 	p.curToken = p.peekToken
+	p.curDoc = p.peekDoc
+
 	p.peekToken = p.l.NextToken()
+	p.peekDoc = ""
+
+	// Doc comments are not part of the grammar. Consecutive lines are
+	// collected and attached to the declaration that follows them.
+	var lines []string
+	for p.peekToken.Type == tokens.DOC_COMMENT {
+		lines = append(lines, p.peekToken.Literal)
+		p.peekToken = p.l.NextToken()
+	}
+	p.peekDoc = strings.Join(lines, "\n")
 }
 
 // registerPrefix registers a prefix parse function.
@@ -110,21 +189,110 @@ func (p *Parser) ParseProgram() *ast.Program {
 	var program *ast.Program = &ast.Program{}
 	program.Statements = []ast.Statement{}
 
-	// Iterate over the tokens until we reach the end of file.
-	for p.curToken.Type != tokens.EOF {
-		// Parse the statement and append it to the program.
+	// Parse statements until we reach the end of file.
+	program.Statements = p.parseStatements(program.Statements, tokens.EOF)
+
+	// Return the program.
+	return program
+}
+
+// parseStatements parses statements, appending them to list, until the
+// current token is end or EOF. A statement with a syntax error is dropped and
+// the parser resynchronizes at the next statement boundary, so that every
+// independent error in the list gets reported.
+func (p *Parser) parseStatements(list []ast.Statement, end tokens.TokenType) []ast.Statement {
+	var depth int = p.depth
+
+	for !p.curTokenIs(end) && !p.curTokenIs(tokens.EOF) {
+		var start tokens.Token = p.curToken
 		var stmt ast.Statement = p.parseStatement()
 
+		if p.panicking {
+			p.synchronize(start, depth)
+			continue
+		}
+
 		if stmt != nil {
-			program.Statements = append(program.Statements, stmt)
+			list = append(list, stmt)
 		}
 
-		// Advance to the next token.
 		p.nextToken()
 	}
 
-	// Return the program.
-	return program
+	return list
+}
+
+// synchronize skips tokens after a syntax error in the statement that began
+// at start, until the parser is somewhere a new statement of the list at the
+// given brace depth can begin: just past a ';', or on a 'let', 'return', 'fn',
+// the '}' that closes the list, or EOF. Tokens inside nested braces are
+// skipped whole. The parser always moves past start, so it cannot get stuck.
+func (p *Parser) synchronize(start tokens.Token, depth int) {
+	p.panicking = false
+
+	if p.curToken == start {
+		p.nextToken()
+	}
+
+	for !p.curTokenIs(tokens.EOF) {
+		if p.depth <= depth {
+			switch p.curToken.Type {
+			case tokens.SEMICOLON:
+				p.nextToken()
+				return
+			case tokens.LET, tokens.CONST, tokens.RETURN, tokens.FUNCTION, tokens.WHILE, tokens.FOR, tokens.RBRACE:
+				return
+			}
+		}
+
+		p.nextToken()
+	}
+}
+
+// addError records a syntax error, unless an earlier error in the same
+// statement has already put the parser into panic mode.
+func (p *Parser) addError(err *Error) {
+	if p.panicking {
+		return
+	}
+
+	p.panicking = true
+	p.errors = append(p.errors, err)
+}
+
+// addScopeError records an error in the way a statement uses a name. The
+// statement itself is well-formed, so unlike addError this does not put the
+// parser into panic mode.
+func (p *Parser) addScopeError(err *Error) {
+	if !p.panicking {
+		p.errors = append(p.errors, err)
+	}
+}
+
+// declare records that name is bound in the current scope by a let, const,
+// fn or for-in statement. Redeclaring a constant of the same scope is an
+// error.
+func (p *Parser) declare(name *ast.Identifier, constant bool) {
+	var scope map[string]bool = p.scopes[len(p.scopes)-1]
+
+	if scope[name.Value] {
+		p.addScopeError(newError(name.Pos(), "", name.Token.Type, "cannot redeclare constant: %s", name.Value))
+		return
+	}
+
+	scope[name.Value] = constant
+}
+
+// isConstant reports whether the innermost declaration of name seen so far
+// is a const statement.
+func (p *Parser) isConstant(name string) bool {
+	for i := len(p.scopes) - 1; i >= 0; i-- {
+		if constant, ok := p.scopes[i][name]; ok {
+			return constant
+		}
+	}
+
+	return false
 }
 
 // parseStatement parses a statement.
@@ -132,8 +300,23 @@ func (p *Parser) parseStatement() ast.Statement {
 	switch p.curToken.Type {
 	case tokens.LET:
 		return p.parseLetStatement()
+	case tokens.CONST:
+		return p.parseConstStatement()
 	case tokens.RETURN:
 		return p.parseReturnStatement()
+	case tokens.LBRACE:
+		return p.parseBlockOrHashStatement()
+	case tokens.FUNCTION:
+		if p.peekTokenIs(tokens.IDENT) {
+			return p.parseFunctionStatement()
+		}
+		return p.parseExpressionStatement()
+	case tokens.WHILE:
+		return p.parseWhileStatement()
+	case tokens.FOR:
+		return p.parseForStatement()
+	case tokens.BREAK, tokens.CONTINUE:
+		return p.parseLoopControlStatement()
 	default:
 		return p.parseExpressionStatement()
 	}
@@ -149,16 +332,47 @@ func (p *Parser) parseBoolean() ast.Expression {
 	return &ast.Boolean{Token: p.curToken, Value: p.curTokenIs(tokens.TRUE)}
 }
 
-// parseIntegerLiteral parses an integer literal.
+// parseIntegerLiteral parses an integer literal, which may have a 0x, 0o or
+// 0b prefix. A literal too large for an int64 is kept as an
+// arbitrary-precision integer in Big.
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	// defer untrace(trace("parseIntegerLiteral"))
 
 	var lit *ast.IntegerLiteral = &ast.IntegerLiteral{Token: p.curToken}
 
-	var value, err = strconv.ParseInt(p.curToken.Literal, 0, 64)
+	// Only a 0x, 0o or 0b prefix selects another base. Without one, the
+	// literal is decimal even if it starts with a zero, so 010 is ten.
+	var literal string = p.curToken.Literal
+	var base int = 0
+	if len(literal) < 2 || literal[0] != '0' || !strings.ContainsRune("xXoObB", rune(literal[1])) {
+		literal, base = strings.ReplaceAll(literal, "_", ""), 10
+	}
+
+	var value, err = strconv.ParseInt(literal, base, 64)
+	if errors.Is(err, strconv.ErrRange) {
+		if n, ok := new(big.Int).SetString(literal, base); ok {
+			lit.Big = n
+			return lit
+		}
+	}
+	if err != nil {
+		p.addError(newError(p.curToken.Pos, "", p.curToken.Type, "could not parse %q as integer", p.curToken.Literal))
+		return nil
+	}
+
+	lit.Value = value
+
+	return lit
+}
+
+// parseFloatLiteral parses a floating-point literal. A literal too large to
+// represent, such as 1e999, is an error rather than an infinity.
+func (p *Parser) parseFloatLiteral() ast.Expression {
+	var lit *ast.FloatLiteral = &ast.FloatLiteral{Token: p.curToken}
+
+	var value, err = strconv.ParseFloat(strings.ReplaceAll(p.curToken.Literal, "_", ""), 64)
 	if err != nil {
-		var msg string = fmt.Sprintf("could not parse %q as integer", p.curToken.Literal)
-		p.errors = append(p.errors, msg)
+		p.addError(newError(p.curToken.Pos, "", p.curToken.Type, "could not parse %q as float", p.curToken.Literal))
 		return nil
 	}
 
@@ -167,15 +381,21 @@ func (p *Parser) parseIntegerLiteral() ast.Expression {
 	return lit
 }
 
+// parseStringLiteral parses a string literal.
+func (p *Parser) parseStringLiteral() ast.Expression {
+	return &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+}
+
 // parseLetStatement parses a let statement.
 func (p *Parser) parseLetStatement() *ast.LetStatement {
-	var stmt *ast.LetStatement = &ast.LetStatement{Token: p.curToken}
+	var stmt *ast.LetStatement = &ast.LetStatement{Token: p.curToken, Doc: p.curDoc}
 
 	if !p.expectPeek(tokens.IDENT) {
 		return nil
 	}
 
 	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.declare(stmt.Name, false)
 
 	if !p.expectPeek(tokens.ASSIGN) {
 		return nil
@@ -185,7 +405,33 @@ func (p *Parser) parseLetStatement() *ast.LetStatement {
 
 	stmt.Value = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(tokens.SEMICOLON) {
+	if p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseConstStatement parses a const statement.
+func (p *Parser) parseConstStatement() *ast.ConstStatement {
+	var stmt *ast.ConstStatement = &ast.ConstStatement{Token: p.curToken, Doc: p.curDoc}
+
+	if !p.expectPeek(tokens.IDENT) {
+		return nil
+	}
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.declare(stmt.Name, true)
+
+	if !p.expectPeek(tokens.ASSIGN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	stmt.Value = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(tokens.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -200,7 +446,7 @@ func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 
 	stmt.ReturnValue = p.parseExpression(LOWEST)
 
-	for !p.curTokenIs(tokens.SEMICOLON) {
+	if p.peekTokenIs(tokens.SEMICOLON) {
 		p.nextToken()
 	}
 
@@ -224,9 +470,12 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 
 // noPrefixParseFnError returns an error message.
 func (p *Parser) noPrefixParseFnError(t tokens.TokenType) {
-	var msg string = fmt.Sprintf("no prefix parse function for %s found", t)
+	if t == tokens.ILLEGAL {
+		p.addError(newError(p.curToken.Pos, "", t, "illegal token: %s", p.curToken.Literal))
+		return
+	}
 
-	p.errors = append(p.errors, msg)
+	p.addError(newError(p.curToken.Pos, "", t, "no prefix parse function for %s found", t))
 }
 
 // parseExpression parses an expression.
@@ -240,8 +489,13 @@ func (p *Parser) parseExpression(precedence int) ast.Expression {
 		return nil
 	}
 
-	leftExp := prefix()
+	return p.parseExpressionFrom(prefix(), precedence)
+}
 
+// parseExpressionFrom continues parsing an expression whose leftmost operand
+// has already been parsed, applying infix parse functions while the next
+// operator binds tighter than precedence.
+func (p *Parser) parseExpressionFrom(leftExp ast.Expression, precedence int) ast.Expression {
 	for !p.peekTokenIs(tokens.SEMICOLON) && precedence < p.peekPrecedence() {
 		infix := p.infixParseFns[p.peekToken.Type]
 
@@ -291,6 +545,34 @@ func (p *Parser) parseInfixExpression(left ast.Expression) ast.Expression {
 	return expression
 }
 
+// parseAssignExpression parses an assignment. Assignment is right
+// associative, so a = b = 1 assigns 1 to b and then to a.
+func (p *Parser) parseAssignExpression(target ast.Expression) ast.Expression {
+	expression := &ast.AssignExpression{
+		Token:    p.curToken,
+		Operator: p.curToken.Literal,
+		Target:   target,
+	}
+
+	switch target := target.(type) {
+	case *ast.Identifier:
+		if p.isConstant(target.Value) {
+			p.addScopeError(newError(target.Pos(), "", p.curToken.Type, "cannot assign to constant: %s", target.Value))
+		}
+	case *ast.IndexExpression:
+	default:
+		if target != nil {
+			p.addError(newError(target.Pos(), "", p.curToken.Type, "cannot assign to %s", target.String()))
+		}
+		return nil
+	}
+
+	p.nextToken()
+	expression.Value = p.parseExpression(ASSIGN - 1)
+
+	return expression
+}
+
 func (p *Parser) parseIfExpression() ast.Expression {
 	expression := &ast.IfExpression{Token: p.curToken}
 
@@ -330,16 +612,151 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 
 	p.nextToken()
 
-	for !p.curTokenIs(tokens.RBRACE) && !p.curTokenIs(tokens.EOF) {
-		stmt := p.parseStatement()
-		if stmt != nil {
-			block.Statements = append(block.Statements, stmt)
+	return p.parseBlockBody(block)
+}
+
+// parseBlockBody parses statements into block until the closing brace,
+// starting at the current token.
+func (p *Parser) parseBlockBody(block *ast.BlockStatement) *ast.BlockStatement {
+	block.Statements = p.parseStatements(block.Statements, tokens.RBRACE)
+
+	return block
+}
+
+// parseBlockOrHashStatement parses a statement that starts with '{', which is
+// either a block or an expression statement holding a hash literal. The two
+// are told apart by parsing the first expression inside the braces: if it is
+// followed by ':' it was a hash key, otherwise it was the block's first
+// statement. An empty '{}' is a hash literal.
+func (p *Parser) parseBlockOrHashStatement() ast.Statement {
+	var lbrace tokens.Token = p.curToken
+
+	switch p.peekToken.Type {
+	case tokens.RBRACE:
+		return p.finishHashStatement(lbrace, p.parseHashLiteral())
+	case tokens.LET, tokens.CONST, tokens.RETURN, tokens.LBRACE, tokens.WHILE, tokens.FOR, tokens.BREAK, tokens.CONTINUE:
+		return p.parseBlockStatement()
+	}
+
+	p.nextToken()
+
+	// A named function can only be declared in a block; without the name,
+	// fn starts a function literal that may still be a hash key.
+	if p.curTokenIs(tokens.FUNCTION) && p.peekTokenIs(tokens.IDENT) {
+		return p.parseBlockBody(&ast.BlockStatement{Token: lbrace})
+	}
+
+	var first tokens.Token = p.curToken
+	var exp ast.Expression = p.parseExpression(LOWEST)
+
+	if p.peekTokenIs(tokens.COLON) {
+		hash := &ast.HashLiteral{Token: lbrace}
+		return p.finishHashStatement(lbrace, p.parseHashLiteralFrom(hash, exp))
+	}
+
+	block := &ast.BlockStatement{Token: lbrace}
+	block.Statements = []ast.Statement{&ast.ExpressionStatement{Token: first, Expression: exp}}
+
+	if p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+	}
+
+	p.nextToken()
+
+	return p.parseBlockBody(block)
+}
+
+// finishHashStatement wraps a hash literal that opened a statement into an
+// expression statement, parsing any operators that follow it.
+func (p *Parser) finishHashStatement(lbrace tokens.Token, hash ast.Expression) ast.Statement {
+	var stmt *ast.ExpressionStatement = &ast.ExpressionStatement{Token: lbrace}
+
+	if hash == nil {
+		return stmt
+	}
+
+	stmt.Expression = p.parseExpressionFrom(hash, LOWEST)
+
+	if p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
+}
+
+// parseHashLiteral parses a hash literal.
+func (p *Parser) parseHashLiteral() ast.Expression {
+	hash := &ast.HashLiteral{Token: p.curToken}
+	hash.Pairs = []ast.HashLiteralPair{}
+
+	if p.peekTokenIs(tokens.RBRACE) {
+		p.nextToken()
+		return hash
+	}
+
+	p.nextToken()
+
+	return p.parseHashLiteralFrom(hash, p.parseExpression(LOWEST))
+}
+
+// parseHashLiteralFrom finishes parsing a hash literal whose first key has
+// already been parsed. The current token is the last token of that key.
+func (p *Parser) parseHashLiteralFrom(hash *ast.HashLiteral, key ast.Expression) ast.Expression {
+	for {
+		if !p.expectPeek(tokens.COLON) {
+			return nil
 		}
 
 		p.nextToken()
+		value := p.parseExpression(LOWEST)
+		hash.Pairs = append(hash.Pairs, ast.HashLiteralPair{Key: key, Value: value})
+
+		if p.peekTokenIs(tokens.RBRACE) {
+			break
+		}
+
+		if !p.expectPeek(tokens.COMMA) {
+			return nil
+		}
+
+		p.nextToken()
+		key = p.parseExpression(LOWEST)
 	}
 
-	return block
+	p.nextToken()
+
+	return hash
+}
+
+// parseFunctionStatement parses a named function declaration.
+func (p *Parser) parseFunctionStatement() ast.Statement {
+	var stmt *ast.FunctionStatement = &ast.FunctionStatement{Token: p.curToken, Doc: p.curDoc}
+
+	p.nextToken()
+
+	stmt.Name = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.declare(stmt.Name, false)
+
+	var lit *ast.FunctionLiteral = &ast.FunctionLiteral{Token: stmt.Token}
+
+	if !p.expectPeek(tokens.LPAREN) {
+		return nil
+	}
+
+	lit.Parameters = p.parseFunctionParameters()
+
+	if !p.expectPeek(tokens.LBRACE) {
+		return nil
+	}
+
+	lit.Body = p.parseFunctionBody(lit.Parameters)
+	stmt.Function = lit
+
+	if p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return stmt
 }
 
 // parseFunctionLiteral parses a function literal.
@@ -356,7 +773,7 @@ func (p *Parser) parseFunctionLiteral() ast.Expression {
 		return nil
 	}
 
-	lit.Body = p.parseBlockStatement()
+	lit.Body = p.parseFunctionBody(lit.Parameters)
 
 	return lit
 
@@ -406,34 +823,57 @@ func (p *Parser) parseGroupedExpression() ast.Expression {
 // parseCallExpression parses a call expression.
 func (p *Parser) parseCallExpression(function ast.Expression) ast.Expression {
 	exp := &ast.CallExpression{Token: p.curToken, Function: function}
-	exp.Arguments = p.parseCallArguments()
+	exp.Arguments = p.parseExpressionList(tokens.RPAREN)
 
 	return exp
 }
 
-// parseCallArguments parses call arguments.
-func (p *Parser) parseCallArguments() []ast.Expression {
-	args := []ast.Expression{}
+// parseArrayLiteral parses an array literal.
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	array := &ast.ArrayLiteral{Token: p.curToken}
+	array.Elements = p.parseExpressionList(tokens.RBRACKET)
 
-	if p.peekTokenIs(tokens.RPAREN) {
+	return array
+}
+
+// parseIndexExpression parses an index expression.
+func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
+	exp := &ast.IndexExpression{Token: p.curToken, Left: left}
+
+	p.nextToken()
+	exp.Index = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(tokens.RBRACKET) {
+		return nil
+	}
+
+	return exp
+}
+
+// parseExpressionList parses a comma-separated list of expressions terminated
+// by the given token. It is shared by call arguments and array literals.
+func (p *Parser) parseExpressionList(end tokens.TokenType) []ast.Expression {
+	list := []ast.Expression{}
+
+	if p.peekTokenIs(end) {
 		p.nextToken()
-		return args
+		return list
 	}
 
 	p.nextToken()
-	args = append(args, p.parseExpression(LOWEST))
+	list = append(list, p.parseExpression(LOWEST))
 
 	for p.peekTokenIs(tokens.COMMA) {
 		p.nextToken()
 		p.nextToken()
-		args = append(args, p.parseExpression(LOWEST))
+		list = append(list, p.parseExpression(LOWEST))
 	}
 
-	if !p.expectPeek(tokens.RPAREN) {
+	if !p.expectPeek(end) {
 		return nil
 	}
 
-	return args
+	return list
 }
 
 // curTokenIs returns true if the current token is of the given type.
@@ -460,15 +900,13 @@ func (p *Parser) expectPeek(t tokens.TokenType) bool {
 }
 
 // Errors returns the parser errors.
-func (p *Parser) Errors() []string {
+func (p *Parser) Errors() []*Error {
 	return p.errors
 }
 
 // peekError returns an error message.
 func (p *Parser) peekError(t tokens.TokenType) {
-	var msg string = fmt.Sprintf("expected next token to be %s, got %s instead", t, p.peekToken.Type)
-
-	p.errors = append(p.errors, msg)
+	p.addError(newError(p.peekToken.Pos, t, p.peekToken.Type, "expected next token to be %s, got %s instead", t, p.peekToken.Type))
 }
 
 // peek and cur precedences
@@ -488,3 +926,175 @@ func (p *Parser) curPrecedence() int {
 
 	return LOWEST
 }
+
+// parseFunctionBody parses the body of a function. The body is a new scope in
+// which the parameters are declared. A loop around the function does not
+// extend into it, so break and continue cannot cross the function boundary.
+func (p *Parser) parseFunctionBody(parameters []*ast.Identifier) *ast.BlockStatement {
+	var loops int = p.loops
+	p.loops = 0
+	defer func() { p.loops = loops }()
+
+	var scope map[string]bool = map[string]bool{}
+	for _, param := range parameters {
+		scope[param.Value] = false
+	}
+	p.scopes = append(p.scopes, scope)
+	defer func() { p.scopes = p.scopes[:len(p.scopes)-1] }()
+
+	return p.parseBlockStatement()
+}
+
+// parseLoopBody parses the body of a loop, in which break and continue are
+// allowed.
+func (p *Parser) parseLoopBody() *ast.BlockStatement {
+	if !p.expectPeek(tokens.LBRACE) {
+		return nil
+	}
+
+	p.loops++
+	defer func() { p.loops-- }()
+
+	var body *ast.BlockStatement = p.parseBlockStatement()
+
+	if p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+	}
+
+	return body
+}
+
+// parseWhileStatement parses while (condition) { body }.
+func (p *Parser) parseWhileStatement() ast.Statement {
+	var stmt *ast.WhileStatement = &ast.WhileStatement{Token: p.curToken}
+
+	if !p.expectPeek(tokens.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+	stmt.Condition = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(tokens.RPAREN) {
+		return nil
+	}
+
+	if stmt.Body = p.parseLoopBody(); stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseForStatement parses either a for-in loop, for (x in xs) { body }, or a
+// C-style loop, for (init; condition; update) { body }.
+func (p *Parser) parseForStatement() ast.Statement {
+	var token tokens.Token = p.curToken
+
+	if !p.expectPeek(tokens.LPAREN) {
+		return nil
+	}
+
+	p.nextToken()
+
+	if p.curTokenIs(tokens.IDENT) && p.peekTokenIs(tokens.IN) {
+		return p.parseForInStatement(token)
+	}
+
+	var stmt *ast.ForStatement = &ast.ForStatement{Token: token}
+
+	if !p.curTokenIs(tokens.SEMICOLON) {
+		if stmt.Init = p.parseForClause(); stmt.Init == nil {
+			return nil
+		}
+		if !p.curTokenIs(tokens.SEMICOLON) && !p.expectPeek(tokens.SEMICOLON) {
+			return nil
+		}
+	}
+
+	if !p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+		stmt.Condition = p.parseExpression(LOWEST)
+	}
+
+	if !p.expectPeek(tokens.SEMICOLON) {
+		return nil
+	}
+
+	if !p.peekTokenIs(tokens.RPAREN) {
+		p.nextToken()
+		if stmt.Update = p.parseForClause(); stmt.Update == nil {
+			return nil
+		}
+	}
+
+	if !p.expectPeek(tokens.RPAREN) {
+		return nil
+	}
+
+	if stmt.Body = p.parseLoopBody(); stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseForClause parses the init or update clause of a C-style for loop,
+// which is a let statement or an expression.
+func (p *Parser) parseForClause() ast.Statement {
+	if p.curTokenIs(tokens.LET) {
+		if stmt := p.parseLetStatement(); stmt != nil {
+			return stmt
+		}
+		return nil
+	}
+
+	var stmt *ast.ExpressionStatement = &ast.ExpressionStatement{Token: p.curToken}
+	if stmt.Expression = p.parseExpression(LOWEST); stmt.Expression == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseForInStatement parses the rest of for (x in iterable) { body }, starting
+// at the loop variable.
+func (p *Parser) parseForInStatement(token tokens.Token) ast.Statement {
+	var stmt *ast.ForInStatement = &ast.ForInStatement{Token: token}
+
+	stmt.Variable = &ast.Identifier{Token: p.curToken, Value: p.curToken.Literal}
+	p.declare(stmt.Variable, false)
+
+	p.nextToken()
+	p.nextToken()
+	stmt.Iterable = p.parseExpression(LOWEST)
+
+	if !p.expectPeek(tokens.RPAREN) {
+		return nil
+	}
+
+	if stmt.Body = p.parseLoopBody(); stmt.Body == nil {
+		return nil
+	}
+
+	return stmt
+}
+
+// parseLoopControlStatement parses break or continue.
+func (p *Parser) parseLoopControlStatement() ast.Statement {
+	var token tokens.Token = p.curToken
+
+	if p.loops == 0 {
+		p.addError(newError(token.Pos, "", token.Type, "%s outside of a loop", token.Literal))
+		return nil
+	}
+
+	if p.peekTokenIs(tokens.SEMICOLON) {
+		p.nextToken()
+	}
+
+	if token.Type == tokens.BREAK {
+		return &ast.BreakStatement{Token: token}
+	}
+	return &ast.ContinueStatement{Token: token}
+}
@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"mana/ast"
 	"mana/lexer"
+	"mana/tokens"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestLetStatements(t *testing.T) {
@@ -43,7 +46,7 @@ func TestLetStatements(t *testing.T) {
 }
 
 func checkParserErrors(t *testing.T, p *Parser) {
-	var errors []string = p.Errors()
+	var errors []*Error = p.Errors()
 
 	if len(errors) == 0 {
 		return
@@ -51,8 +54,8 @@ func checkParserErrors(t *testing.T, p *Parser) {
 
 	t.Errorf("parser has %d errors", len(errors))
 
-	for _, msg := range errors {
-		t.Errorf("parser error: %q", msg)
+	for _, err := range errors {
+		t.Errorf("parser error: %q", err.Error())
 	}
 
 	t.FailNow()
@@ -261,6 +264,187 @@ func TestIntegerLiteralExpression(t *testing.T) {
 	}
 }
 
+func TestIntegerLiteralForms(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int64
+	}{
+		{"0xFF", 255},
+		{"0o17", 15},
+		{"0b1010", 10},
+		{"1_000_000", 1000000},
+		{"0x_7fff_ffff_ffff_ffff", 9223372036854775807},
+		{"010", 10},
+		{"0_10", 10},
+		{"09", 9},
+		{"007", 7},
+		{"0", 0},
+		{"0_0", 0},
+	}
+
+	for _, tt := range tests {
+		var p *Parser = New(lexer.New(tt.input))
+		var program *ast.Program = p.ParseProgram()
+		checkParserErrors(t, p)
+
+		literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+		if literal.Value != tt.expected || literal.Big != nil {
+			t.Errorf("%s: literal wrong. want Value=%d, got Value=%d Big=%v", tt.input, tt.expected, literal.Value, literal.Big)
+		}
+	}
+}
+
+func TestBigIntegerLiteral(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"9223372036854775808", "9223372036854775808"},
+		{"123_456_789_012_345_678_901", "123456789012345678901"},
+		{"0xffff_ffff_ffff_ffff_ffff", "1208925819614629174706175"},
+		{"0b1" + strings.Repeat("0", 64), "18446744073709551616"},
+		{"09223372036854775808", "9223372036854775808"},
+	}
+
+	for _, tt := range tests {
+		var p *Parser = New(lexer.New(tt.input))
+		var program *ast.Program = p.ParseProgram()
+		checkParserErrors(t, p)
+
+		literal := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.IntegerLiteral)
+		if literal.Big == nil || literal.Big.String() != tt.expected {
+			t.Errorf("%s: literal.Big wrong. want=%s, got=%v", tt.input, tt.expected, literal.Big)
+		}
+
+		if literal.String() != tt.input {
+			t.Errorf("%s: literal.String() wrong. got=%s", tt.input, literal.String())
+		}
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	var input string = `
+/// The answer.
+let answer = 42;
+
+/// Adds two numbers.
+/// Both must be integers.
+fn add(x, y) { x + y }
+
+// an ordinary comment
+let plain = 1;
+
+/// Dangling: not in front of a declaration.
+add(1, 2);
+let after = 3;
+`
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	var expected = []string{"The answer.", "Adds two numbers.\nBoth must be integers.", "", "", ""}
+
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("program has wrong number of statements. got=%d", len(program.Statements))
+	}
+
+	for i, want := range expected {
+		var doc string
+		switch stmt := program.Statements[i].(type) {
+		case *ast.LetStatement:
+			doc = stmt.Doc
+		case *ast.FunctionStatement:
+			doc = stmt.Doc
+		default:
+			continue
+		}
+
+		if doc != want {
+			t.Errorf("statement %d has wrong doc. want=%q, got=%q", i, want, doc)
+		}
+	}
+}
+
+func TestUnterminatedBlockCommentError(t *testing.T) {
+	var l *lexer.Lexer = lexer.New("let x = 1;\n/* never closed\n")
+	var p *Parser = New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error, got=%d", len(p.Errors()))
+	}
+
+	if p.Errors()[0].Error() != "2:1: illegal token: unterminated block comment" {
+		t.Errorf("wrong error. got=%q", p.Errors()[0].Error())
+	}
+}
+
+func TestFloatLiteralExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected float64
+	}{
+		{"3.14;", 3.14},
+		{"1e-9;", 1e-9},
+		{"1_000.5;", 1000.5},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		var program *ast.Program = p.ParseProgram()
+		checkParserErrors(t, p)
+
+		stmt := program.Statements[0].(*ast.ExpressionStatement)
+		literal, ok := stmt.Expression.(*ast.FloatLiteral)
+
+		if !ok {
+			t.Fatalf("exp not *ast.FloatLiteral. got=%T", stmt.Expression)
+		}
+
+		if literal.Value != tt.expected {
+			t.Errorf("literal.Value not %g. got=%g", tt.expected, literal.Value)
+		}
+	}
+}
+
+func TestFloatLiteralOutOfRange(t *testing.T) {
+	var l *lexer.Lexer = lexer.New("1e999;")
+	var p *Parser = New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) != 1 {
+		t.Fatalf("expected 1 error, got=%d", len(p.Errors()))
+	}
+
+	if p.Errors()[0].Error() != `1:1: could not parse "1e999" as float` {
+		t.Errorf("wrong error. got=%q", p.Errors()[0].Error())
+	}
+}
+
+// String literal expression tests.
+func TestStringLiteralExpression(t *testing.T) {
+	var input string = `"hello world";`
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	literal, ok := stmt.Expression.(*ast.StringLiteral)
+
+	if !ok {
+		t.Fatalf("exp not *ast.StringLiteral. got=%T", stmt.Expression)
+	}
+
+	if literal.Value != "hello world" {
+		t.Errorf("literal.Value not %q. got=%q", "hello world", literal.Value)
+	}
+}
+
 // Boolean expression tests.
 
 func TestBooleanExpression(t *testing.T) {
@@ -390,6 +574,12 @@ func TestParsingInfixExpressions(t *testing.T) {
 		{"5 < 5;", 5, "<", 5},
 		{"5 == 5;", 5, "==", 5},
 		{"5 != 5;", 5, "!=", 5},
+		{"5 % 5;", 5, "%", 5},
+		{"5 <= 5;", 5, "<=", 5},
+		{"5 >= 5;", 5, ">=", 5},
+		{"true && false", true, "&&", false},
+		{"true || false", true, "||", false},
+		{"a ?? b", "a", "??", "b"},
 		{"true == true", true, "==", true},
 		{"true != false", true, "!=", false},
 		{"false == false", false, "==", false},
@@ -471,6 +661,30 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"a + b / c",
 			"(a + (b / c))",
 		},
+		{
+			"a + b % c * d",
+			"(a + ((b % c) * d))",
+		},
+		{
+			"a <= b == c >= d",
+			"((a <= b) == (c >= d))",
+		},
+		{
+			"a || b && c == d",
+			"(a || (b && (c == d)))",
+		},
+		{
+			"a && b || c && d",
+			"((a && b) || (c && d))",
+		},
+		{
+			"a ?? b || c ?? d",
+			"((a ?? (b || c)) ?? d)",
+		},
+		{
+			"!a && -b < c",
+			"((!a) && ((-b) < c))",
+		},
 		{
 			"a + b * c + d / e - f",
 			"(((a + (b * c)) + (d / e)) - f)",
@@ -519,6 +733,30 @@ func TestOperatorPrecedenceParsing(t *testing.T) {
 			"add(a + b + c * d / f + g)",
 			"add((((a + b) + ((c * d) / f)) + g))",
 		},
+		{
+			"a * [1, 2, 3, 4][b * c] * d",
+			"((a * ([1, 2, 3, 4][(b * c)])) * d)",
+		},
+		{
+			"add(a * b[2], b[1], 2 * [1, 2][1])",
+			"add((a * (b[2])), (b[1]), (2 * ([1, 2][1])))",
+		},
+		{
+			"x = y = a + b",
+			"(x = (y = (a + b)))",
+		},
+		{
+			"x += a || b ?? c",
+			"(x += ((a || b) ?? c))",
+		},
+		{
+			"xs[i + 1] *= 2",
+			"((xs[(i + 1)]) *= 2)",
+		},
+		{
+			"h[\"k\"] %= n -= 1",
+			"((h[k]) %= (n -= 1))",
+		},
 	}
 
 	for _, tt := range tests {
@@ -772,3 +1010,747 @@ func TestCallExpressionParsing(t *testing.T) {
 	testInfixExpression(t, exp.Arguments[1], 2, "*", 3)
 	testInfixExpression(t, exp.Arguments[2], 4, "+", 5)
 }
+
+func TestParsingArrayLiterals(t *testing.T) {
+	var input string = "[1, 2 * 2, 3 + 3]"
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 3 {
+		t.Fatalf("len(array.Elements) not 3. got=%d", len(array.Elements))
+	}
+
+	testIntegerLiteral(t, array.Elements[0], 1)
+	testInfixExpression(t, array.Elements[1], 2, "*", 2)
+	testInfixExpression(t, array.Elements[2], 3, "+", 3)
+}
+
+func TestParsingEmptyArrayLiteral(t *testing.T) {
+	var input string = "[]"
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	array, ok := stmt.Expression.(*ast.ArrayLiteral)
+
+	if !ok {
+		t.Fatalf("exp not ast.ArrayLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(array.Elements) != 0 {
+		t.Errorf("len(array.Elements) not 0. got=%d", len(array.Elements))
+	}
+}
+
+func TestParsingIndexExpressions(t *testing.T) {
+	var input string = "myArray[1 + 1]"
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	indexExp, ok := stmt.Expression.(*ast.IndexExpression)
+
+	if !ok {
+		t.Fatalf("exp not *ast.IndexExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, indexExp.Left, "myArray") {
+		return
+	}
+
+	if !testInfixExpression(t, indexExp.Index, 1, "+", 1) {
+		return
+	}
+}
+
+func TestParsingHashLiteralsStringKeys(t *testing.T) {
+	var input string = `let h = {"one": 1, "two": 2, "three": 3};`
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	hash, ok := program.Statements[0].(*ast.LetStatement).Value.(*ast.HashLiteral)
+
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", program.Statements[0].(*ast.LetStatement).Value)
+	}
+
+	expected := []struct {
+		key   string
+		value int64
+	}{
+		{"one", 1},
+		{"two", 2},
+		{"three", 3},
+	}
+
+	if len(hash.Pairs) != len(expected) {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	for i, pair := range hash.Pairs {
+		literal, ok := pair.Key.(*ast.StringLiteral)
+
+		if !ok {
+			t.Errorf("key is not ast.StringLiteral. got=%T", pair.Key)
+			continue
+		}
+
+		if literal.Value != expected[i].key {
+			t.Errorf("key[%d] wrong. want=%q, got=%q", i, expected[i].key, literal.Value)
+		}
+
+		testIntegerLiteral(t, pair.Value, expected[i].value)
+	}
+}
+
+func TestParsingHashLiteralsWithExpressions(t *testing.T) {
+	var input string = `({"one": 0 + 1, 2: 10 - 8, true: 15 / 5})`
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[0].(*ast.ExpressionStatement)
+	hash, ok := stmt.Expression.(*ast.HashLiteral)
+
+	if !ok {
+		t.Fatalf("exp is not ast.HashLiteral. got=%T", stmt.Expression)
+	}
+
+	if len(hash.Pairs) != 3 {
+		t.Fatalf("hash.Pairs has wrong length. got=%d", len(hash.Pairs))
+	}
+
+	testInfixExpression(t, hash.Pairs[0].Value, 0, "+", 1)
+	testIntegerLiteral(t, hash.Pairs[1].Key, 2)
+	testInfixExpression(t, hash.Pairs[1].Value, 10, "-", 8)
+	testBooleanLiteral(t, hash.Pairs[2].Key, true)
+	testInfixExpression(t, hash.Pairs[2].Value, 15, "/", 5)
+}
+
+func TestBlockOrHashStatement(t *testing.T) {
+	tests := []struct {
+		input    string
+		isHash   bool
+		expected string
+	}{
+		{`{}`, true, "{}"},
+		{`{"a": 1}`, true, "{a: 1}"},
+		{`{x: y, 1: 2}`, true, "{x: y, 1: 2}"},
+		{`{"a": 1}["a"]`, true, "({a: 1}[a])"},
+		{`{ x }`, false, "x"},
+		{`{ x; y }`, false, "xy"},
+		{`{ let x = 1; x }`, false, "let x = 1;x"},
+		{`{ if (a) { b } }`, false, "ifa b"},
+		{`{ { x } }`, false, "x"},
+		{`{ fn f() { 1 } puts(f()); }`, false, "fn f()1puts(f())"},
+		{`{ fn() { 1 }: 2 }`, true, "{fn()1: 2}"},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		var program *ast.Program = p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: program.Statements does not contain 1 statement. got=%d", tt.input, len(program.Statements))
+		}
+
+		stmt := program.Statements[0]
+
+		if tt.isHash {
+			if _, ok := stmt.(*ast.ExpressionStatement); !ok {
+				t.Errorf("%q: stmt is not ast.ExpressionStatement. got=%T", tt.input, stmt)
+				continue
+			}
+		} else if _, ok := stmt.(*ast.BlockStatement); !ok {
+			t.Errorf("%q: stmt is not ast.BlockStatement. got=%T", tt.input, stmt)
+			continue
+		}
+
+		if stmt.String() != tt.expected {
+			t.Errorf("%q: expected=%q, got=%q", tt.input, tt.expected, stmt.String())
+		}
+	}
+}
+
+func TestFunctionStatementParsing(t *testing.T) {
+	var input string = `
+	fn add(x, y) { x + y; }
+	fn(x) { x; };
+	`
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 2 {
+		t.Fatalf("program.Statements does not contain %d statements. got=%d", 2, len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.FunctionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[0] is not ast.FunctionStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Name, "add") {
+		return
+	}
+
+	if len(stmt.Function.Parameters) != 2 {
+		t.Fatalf("function parameters wrong. want 2, got=%d", len(stmt.Function.Parameters))
+	}
+
+	testLiteralExpression(t, stmt.Function.Parameters[0], "x")
+	testLiteralExpression(t, stmt.Function.Parameters[1], "y")
+
+	if stmt.String() != "fn add(x, y)(x + y)" {
+		t.Errorf("stmt.String() wrong. got=%q", stmt.String())
+	}
+
+	exprStmt, ok := program.Statements[1].(*ast.ExpressionStatement)
+
+	if !ok {
+		t.Fatalf("program.Statements[1] is not ast.ExpressionStatement. got=%T", program.Statements[1])
+	}
+
+	if _, ok := exprStmt.Expression.(*ast.FunctionLiteral); !ok {
+		t.Fatalf("exprStmt.Expression is not ast.FunctionLiteral. got=%T", exprStmt.Expression)
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let x 5;", "1:7: expected next token to be =, got INT instead"},
+		{"let x = 1;\nadd(1, 2;", "2:9: expected next token to be ), got ; instead"},
+		{"\n\n  ;", "3:3: no prefix parse function for ; found"},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) == 0 {
+			t.Errorf("%q: expected parser errors, got none", tt.input)
+			continue
+		}
+
+		if p.Errors()[0].Error() != tt.expected {
+			t.Errorf("%q: wrong first error. expected=%q, got=%q", tt.input, tt.expected, p.Errors()[0].Error())
+		}
+	}
+}
+
+func TestNodePositions(t *testing.T) {
+	var input string = "let x = 1;\n  x + foo(2);"
+
+	var l *lexer.Lexer = lexer.NewFile("pos.mana", input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt := program.Statements[1].(*ast.ExpressionStatement)
+	infix := stmt.Expression.(*ast.InfixExpression)
+	call := infix.Right.(*ast.CallExpression)
+
+	tests := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{program, "pos.mana:1:1"},
+		{program.Statements[0], "pos.mana:1:1"},
+		{stmt, "pos.mana:2:3"},
+		{infix, "pos.mana:2:5"},
+		{infix.Left, "pos.mana:2:3"},
+		{call.Function, "pos.mana:2:7"},
+		{call.Arguments[0], "pos.mana:2:11"},
+	}
+
+	for i, tt := range tests {
+		if tt.node.Pos().String() != tt.expected {
+			t.Errorf("tests[%d] - position wrong. expected=%q, got=%q", i, tt.expected, tt.node.Pos().String())
+		}
+	}
+}
+
+func TestStructuredErrors(t *testing.T) {
+	var input string = "let x = 1;\nadd(1, 2;"
+
+	var l *lexer.Lexer = lexer.NewFile("main.mana", input)
+	var p *Parser = New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	err := p.Errors()[0]
+
+	if err.Expected != tokens.RPAREN {
+		t.Errorf("err.Expected wrong. expected=%q, got=%q", tokens.RPAREN, err.Expected)
+	}
+
+	if err.Actual != tokens.SEMICOLON {
+		t.Errorf("err.Actual wrong. expected=%q, got=%q", tokens.SEMICOLON, err.Actual)
+	}
+
+	if err.Pos.Line != 2 || err.Pos.Column != 9 {
+		t.Errorf("err.Pos wrong. expected=2:9, got=%d:%d", err.Pos.Line, err.Pos.Column)
+	}
+
+	expected := "error: expected next token to be ), got ; instead\n" +
+		" --> main.mana:2:9\n" +
+		"  |\n" +
+		"2 | add(1, 2;\n" +
+		"  |         ^\n"
+
+	if err.Render(input) != expected {
+		t.Errorf("err.Render wrong.\nexpected=\n%s\ngot=\n%s", expected, err.Render(input))
+	}
+}
+
+func TestRenderKeepsTabs(t *testing.T) {
+	var input string = "\tlet x 5;"
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "error: expected next token to be =, got INT instead\n" +
+		" --> 1:8\n" +
+		"  |\n" +
+		"1 | \tlet x 5;\n" +
+		"  | \t      ^\n"
+
+	if got := p.Errors()[0].Render(input); got != expected {
+		t.Errorf("Render wrong.\nexpected=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+func TestRenderCountsRunes(t *testing.T) {
+	var input string = "let größe 5;"
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	expected := "error: expected next token to be =, got INT instead\n" +
+		" --> 1:11\n" +
+		"  |\n" +
+		"1 | let größe 5;\n" +
+		"  |           ^\n"
+
+	if got := p.Errors()[0].Render(input); got != expected {
+		t.Errorf("Render wrong.\nexpected=\n%s\ngot=\n%s", expected, got)
+	}
+}
+
+// tokenSlice is a TokenSource that returns a fixed list of tokens.
+type tokenSlice []tokens.Token
+
+func (ts *tokenSlice) NextToken() tokens.Token {
+	if len(*ts) == 0 {
+		return tokens.Token{Type: tokens.EOF}
+	}
+	var tok tokens.Token = (*ts)[0]
+	*ts = (*ts)[1:]
+	return tok
+}
+
+func TestTokenSource(t *testing.T) {
+	var source *tokenSlice = &tokenSlice{
+		{Type: tokens.LET, Literal: "let"},
+		{Type: tokens.IDENT, Literal: "x"},
+		{Type: tokens.ASSIGN, Literal: "="},
+		{Type: tokens.INT, Literal: "1"},
+		{Type: tokens.PLUS, Literal: "+"},
+		{Type: tokens.INT, Literal: "2"},
+		{Type: tokens.SEMICOLON, Literal: ";"},
+	}
+
+	var p *Parser = New(source)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if got := program.String(); got != "let x = (1 + 2);" {
+		t.Errorf("program.String() wrong. expected=%q, got=%q", "let x = (1 + 2);", got)
+	}
+}
+
+func TestIllegalTokenError(t *testing.T) {
+	var l *lexer.Lexer = lexer.New(`"abc`)
+	var p *Parser = New(l)
+	p.ParseProgram()
+
+	if len(p.Errors()) == 0 {
+		t.Fatalf("expected parser errors, got none")
+	}
+
+	err := p.Errors()[0]
+
+	if err.Actual != tokens.ILLEGAL {
+		t.Errorf("err.Actual wrong. expected=%q, got=%q", tokens.ILLEGAL, err.Actual)
+	}
+
+	if err.Message != "illegal token: unterminated string literal" {
+		t.Errorf("err.Message wrong. got=%q", err.Message)
+	}
+}
+
+func TestErrorRecovery(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{
+			"let x 5; let y = ; let z = 10;",
+			[]string{
+				"1:7: expected next token to be =, got INT instead",
+				"1:18: no prefix parse function for ; found",
+			},
+		},
+		{
+			"let a = (1 + 2; let b = 3;\nreturn );",
+			[]string{
+				"1:15: expected next token to be ), got ; instead",
+				"2:8: no prefix parse function for ) found",
+			},
+		},
+		{
+			"let f = fn(x) {\n  let y 1;\n  x +\n};\nlet g = [1, 2;",
+			[]string{
+				"2:9: expected next token to be =, got INT instead",
+				"4:1: no prefix parse function for } found",
+				"5:14: expected next token to be ], got ; instead",
+			},
+		},
+		{
+			"let h = {\"a\": 1 \"b\": 2}; let ok = 1; )",
+			[]string{
+				"1:17: expected next token to be ,, got STRING instead",
+				"1:38: no prefix parse function for ) found",
+			},
+		},
+		{
+			"} let x = 1; }",
+			[]string{
+				"1:1: no prefix parse function for } found",
+				"1:14: no prefix parse function for } found",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		p.ParseProgram()
+
+		errors := p.Errors()
+
+		if len(errors) != len(tt.expected) {
+			t.Errorf("%q: wrong number of errors. want=%d, got=%d", tt.input, len(tt.expected), len(errors))
+			for _, err := range errors {
+				t.Logf("\t%s", err.Error())
+			}
+			continue
+		}
+
+		for i, expected := range tt.expected {
+			if errors[i].Error() != expected {
+				t.Errorf("%q: errors[%d] wrong. expected=%q, got=%q", tt.input, i, expected, errors[i].Error())
+			}
+		}
+	}
+}
+
+func TestErrorRecoveryKeepsValidStatements(t *testing.T) {
+	var input string = "let a = 1; let b 2; let c = 3; let d = ; let e = 5;"
+
+	var l *lexer.Lexer = lexer.New(input)
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+
+	if len(p.Errors()) != 2 {
+		t.Fatalf("wrong number of errors. want=2, got=%d", len(p.Errors()))
+	}
+
+	expected := []string{"a", "c", "e"}
+
+	if len(program.Statements) != len(expected) {
+		t.Fatalf("program.Statements wrong length. want=%d, got=%d", len(expected), len(program.Statements))
+	}
+
+	for i, name := range expected {
+		testLetStatement(t, program.Statements[i], name)
+	}
+}
+
+func TestMissingTrailingSemicolon(t *testing.T) {
+	tests := []string{
+		"let x = 5",
+		"return 5",
+		"let x = ",
+		"return",
+		"fn f(x) { x",
+		"if (x) { let y = 1",
+	}
+
+	for _, input := range tests {
+		done := make(chan struct{})
+
+		go func() {
+			var l *lexer.Lexer = lexer.New(input)
+			var p *Parser = New(l)
+			p.ParseProgram()
+			close(done)
+		}()
+
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatalf("%q: ParseProgram did not return", input)
+		}
+	}
+}
+
+func TestLoopParsing(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"while (x < 10) { x; }", "while ((x < 10)) x"},
+		{"while (true) { break; continue }", "while (true) break;continue;"},
+		{"for (let i = 0; i < 3; let i = i + 1) { i }", "for (let i = 0; (i < 3); let i = (i + 1)) i"},
+		{"for (;;) { break }", "for (; ; ) break;"},
+		{"for (i; ; f(i)) { }", "for (i; ; f(i)) "},
+		{"for (x in [1, 2]) { puts(x) }", "for (x in [1, 2]) puts(x)"},
+		{"for (x in xs) { for (y in ys) { continue; } }", "for (x in xs) for (y in ys) continue;"},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		var program *ast.Program = p.ParseProgram()
+		checkParserErrors(t, p)
+
+		if len(program.Statements) != 1 {
+			t.Fatalf("%q: expected 1 statement, got=%d", tt.input, len(program.Statements))
+		}
+
+		if got := program.String(); got != tt.expected {
+			t.Errorf("%q: wrong String(). want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestForInStatementParsing(t *testing.T) {
+	var l *lexer.Lexer = lexer.New("for (item in items) { item }")
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ForInStatement)
+	if !ok {
+		t.Fatalf("statement is not *ast.ForInStatement. got=%T", program.Statements[0])
+	}
+
+	if !testIdentifier(t, stmt.Variable, "item") {
+		return
+	}
+
+	if !testIdentifier(t, stmt.Iterable, "items") {
+		return
+	}
+
+	if len(stmt.Body.Statements) != 1 {
+		t.Errorf("body has wrong number of statements. got=%d", len(stmt.Body.Statements))
+	}
+}
+
+func TestAssignExpression(t *testing.T) {
+	var l *lexer.Lexer = lexer.New("total -= price * 2;")
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	stmt, ok := program.Statements[0].(*ast.ExpressionStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ExpressionStatement. got=%T", program.Statements[0])
+	}
+
+	assign, ok := stmt.Expression.(*ast.AssignExpression)
+	if !ok {
+		t.Fatalf("stmt.Expression is not *ast.AssignExpression. got=%T", stmt.Expression)
+	}
+
+	if !testIdentifier(t, assign.Target, "total") {
+		return
+	}
+
+	if assign.Operator != "-=" {
+		t.Errorf("assign.Operator is not %q. got=%q", "-=", assign.Operator)
+	}
+
+	testInfixExpression(t, assign.Value, "price", "*", 2)
+}
+
+func TestInvalidAssignmentTarget(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"1 = 2;", "1:1: cannot assign to 1"},
+		{"let x = 1; x + 1 = 2;", "1:14: cannot assign to (x + 1)"},
+		{"f() += 1;", "1:2: cannot assign to f()"},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Fatalf("%q: expected 1 error, got=%d", tt.input, len(p.Errors()))
+		}
+
+		if got := p.Errors()[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestConstStatement(t *testing.T) {
+	var l *lexer.Lexer = lexer.New("/// The answer.\nconst answer = 6 * 7;")
+	var p *Parser = New(l)
+	var program *ast.Program = p.ParseProgram()
+	checkParserErrors(t, p)
+
+	if len(program.Statements) != 1 {
+		t.Fatalf("program.Statements does not contain 1 statements. got=%d", len(program.Statements))
+	}
+
+	stmt, ok := program.Statements[0].(*ast.ConstStatement)
+	if !ok {
+		t.Fatalf("program.Statements[0] is not *ast.ConstStatement. got=%T", program.Statements[0])
+	}
+
+	if stmt.Name.Value != "answer" || stmt.Doc != "The answer." {
+		t.Errorf("wrong name or doc. got=%q, %q", stmt.Name.Value, stmt.Doc)
+	}
+
+	testInfixExpression(t, stmt.Value, 6, "*", 7)
+
+	if got := stmt.String(); got != "const answer = (6 * 7);" {
+		t.Errorf("stmt.String() wrong. got=%q", got)
+	}
+}
+
+func TestConstChecks(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"const x = 1; x = 2;", []string{"1:14: cannot assign to constant: x"}},
+		{"const x = 1;\nx *= 2;", []string{"2:1: cannot assign to constant: x"}},
+		{"const x = 1; let f = fn() { x += 1; };", []string{"1:29: cannot assign to constant: x"}},
+		{"const x = 1; let x = 2;", []string{"1:18: cannot redeclare constant: x"}},
+		{"const x = 1; const x = 2;", []string{"1:20: cannot redeclare constant: x"}},
+		{"const x = 1; fn x() { }", []string{"1:17: cannot redeclare constant: x"}},
+		{"const x = 1; for (x in []) { }", []string{"1:19: cannot redeclare constant: x"}},
+		{"const x = 1; x = 2; let x = 3; x = 4;", []string{
+			"1:14: cannot assign to constant: x",
+			"1:25: cannot redeclare constant: x",
+			"1:32: cannot assign to constant: x",
+		}},
+		{"const x = 1; let f = fn() { let x = 2; x = 3; };", nil},
+		{"const x = 1; let f = fn(x) { x = 2; };", nil},
+		{"let x = 1; x = 2; const x = 3;", nil},
+		{"let f = fn() { const x = 1; }; let x = 2; x = 3;", nil},
+		{"const xs = [1]; xs[0] = 2;", nil},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		p.ParseProgram()
+
+		var got []string
+		for _, err := range p.Errors() {
+			got = append(got, err.Error())
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: wrong errors.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestLoopControlOutsideLoop(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"break;", "1:1: break outside of a loop"},
+		{"if (true) { continue; }", "1:13: continue outside of a loop"},
+		{"while (true) { fn() { break; } }", "1:23: break outside of a loop"},
+	}
+
+	for _, tt := range tests {
+		var l *lexer.Lexer = lexer.New(tt.input)
+		var p *Parser = New(l)
+		p.ParseProgram()
+
+		if len(p.Errors()) != 1 {
+			t.Fatalf("%q: expected 1 error, got=%d", tt.input, len(p.Errors()))
+		}
+
+		if got := p.Errors()[0].Error(); got != tt.expected {
+			t.Errorf("%q: wrong error. want=%q, got=%q", tt.input, tt.expected, got)
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package repl
+
+import (
+	"fmt"
+	"io"
+	"mana/ast"
+	"mana/evaluator"
+	"mana/lexer"
+	"mana/object"
+	"mana/parser"
+	"mana/tokens"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// session is the state of a running REPL.
+type session struct {
+	env *object.Environment
+	out io.Writer
+}
+
+// eval parses and evaluates source in the session's environment and prints
+// the result, or the errors found.
+func (s *session) eval(source string) {
+	var l *lexer.Lexer = lexer.New(source)
+	var p *parser.Parser = parser.New(l)
+
+	var program = p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, source, p.Errors())
+		return
+	}
+
+	evaluated := evaluator.Eval(program, s.env)
+	if errObj, ok := evaluated.(*object.Error); ok {
+		io.WriteString(s.out, errObj.Traceback()+"\n")
+		return
+	}
+	if evaluated != nil {
+		io.WriteString(s.out, evaluated.Inspect())
+		io.WriteString(s.out, "\n")
+	}
+}
+
+// isCommand reports whether input is a meta-command rather than Mana code.
+// No Mana statement starts with a colon, so the two cannot be confused.
+func isCommand(input string) bool {
+	return strings.HasPrefix(strings.TrimSpace(input), ":")
+}
+
+// runCommand runs a meta-command such as :env or :ast <source>. It reports
+// false if the command ends the session.
+func (s *session) runCommand(input string) bool {
+	input = strings.TrimSpace(input)
+
+	var name, arg string = input, ""
+	if i := strings.IndexFunc(input, unicode.IsSpace); i >= 0 {
+		name, arg = input[:i], strings.TrimSpace(input[i:])
+	}
+
+	switch name {
+	case ":env":
+		s.printEnv()
+	case ":tokens":
+		if s.requireArg(name, arg, "<source>") {
+			s.printTokens(arg)
+		}
+	case ":ast":
+		if s.requireArg(name, arg, "<source>") {
+			s.printAST(arg)
+		}
+	case ":type":
+		if s.requireArg(name, arg, "<expression>") {
+			s.printType(arg)
+		}
+	case ":load":
+		if s.requireArg(name, arg, "<file>") {
+			s.load(arg)
+		}
+	case ":reset":
+		s.env = object.NewEnvironment()
+	case ":quit":
+		return false
+	default:
+		fmt.Fprintf(s.out, "unknown command: %s (try :env, :tokens, :ast, :type, :load, :reset or :quit)\n", name)
+	}
+
+	return true
+}
+
+// requireArg reports whether a command that needs an argument was given one,
+// and prints its usage if not.
+func (s *session) requireArg(name, arg, usage string) bool {
+	if arg == "" {
+		fmt.Fprintf(s.out, "usage: %s %s\n", name, usage)
+		return false
+	}
+	return true
+}
+
+// printEnv prints the bindings of the session, one per line.
+func (s *session) printEnv() {
+	for _, name := range s.env.Names() {
+		value, _ := s.env.Get(name)
+
+		if s.env.IsConstant(name) {
+			fmt.Fprintf(s.out, "const %s = %s\n", name, value.Inspect())
+		} else {
+			fmt.Fprintf(s.out, "%s = %s\n", name, value.Inspect())
+		}
+	}
+}
+
+// printTokens prints the tokens of source, one per line with its position.
+func (s *session) printTokens(source string) {
+	var l *lexer.Lexer = lexer.New(source)
+
+	for {
+		var tok tokens.Token = l.NextToken()
+		fmt.Fprintf(s.out, "%-7s %-12s %q\n", tok.Pos, tok.Type, tok.Literal)
+
+		if tok.Type == tokens.EOF {
+			return
+		}
+	}
+}
+
+// printAST parses source and prints its syntax tree.
+func (s *session) printAST(source string) {
+	var p *parser.Parser = parser.New(lexer.New(source))
+	var program = p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, source, p.Errors())
+		return
+	}
+
+	io.WriteString(s.out, ast.Dump(program))
+}
+
+// printType evaluates source in the session and prints the type of its
+// value. An error is printed as such.
+func (s *session) printType(source string) {
+	var p *parser.Parser = parser.New(lexer.New(source))
+	var program = p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, source, p.Errors())
+		return
+	}
+
+	switch evaluated := evaluator.Eval(program, s.env).(type) {
+	case nil:
+		io.WriteString(s.out, "no value\n")
+	case *object.Error:
+		io.WriteString(s.out, evaluated.Traceback()+"\n")
+	default:
+		io.WriteString(s.out, string(evaluated.Type())+"\n")
+	}
+}
+
+// load evaluates the file at path in the session, so that its definitions
+// become available at the prompt.
+func (s *session) load(path string) {
+	source, err := os.ReadFile(path)
+	if err != nil {
+		fmt.Fprintf(s.out, "cannot load %s: %s\n", path, err)
+		return
+	}
+
+	var p *parser.Parser = parser.New(lexer.NewFile(path, string(source)))
+	var program = p.ParseProgram()
+
+	if len(p.Errors()) != 0 {
+		printParserErrors(s.out, string(source), p.Errors())
+		return
+	}
+
+	if errObj, ok := evaluator.Eval(program, s.env).(*object.Error); ok {
+		io.WriteString(s.out, errObj.Traceback()+"\n")
+	}
+}
@@ -0,0 +1,190 @@
+package repl
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"unicode"
+)
+
+// Control keys, as they arrive in raw mode.
+const (
+	keyCtrlA     = 1
+	keyCtrlC     = 3
+	keyCtrlD     = 4
+	keyCtrlE     = 5
+	keyBackspace = 8
+	keyCtrlU     = 21
+	keyEscape    = 27
+	keyDelete    = 127
+)
+
+// editor reads lines from a terminal with basic line editing: the left and
+// right arrows move the cursor, the up and down arrows walk through the
+// history, and Ctrl-C abandons the line.
+type editor struct {
+	in      *bufio.Reader
+	out     io.Writer
+	history *history
+
+	// raw switches the terminal to raw mode for the duration of one line.
+	// It is nil if the input is already raw, as in tests.
+	raw func() (func(), error)
+}
+
+// lineState is the line being edited.
+type lineState struct {
+	prompt string
+	buf    []rune
+	pos    int // cursor position in buf
+
+	// entry is the history line being shown, len(history.lines) for the
+	// new line, whose text is kept in pending while browsing.
+	entry   int
+	pending []rune
+}
+
+func (e *editor) ReadLine(prompt string) (string, error) {
+	if e.raw != nil {
+		restore, err := e.raw()
+		if err != nil {
+			return "", err
+		}
+		defer restore()
+	}
+
+	var s *lineState = &lineState{prompt: prompt, entry: len(e.history.lines)}
+	fmt.Fprint(e.out, prompt)
+
+	for {
+		r, _, err := e.in.ReadRune()
+		if err != nil {
+			if err == io.EOF && len(s.buf) > 0 {
+				break
+			}
+			return "", err
+		}
+
+		switch r {
+		case '\r', '\n':
+			fmt.Fprint(e.out, "\r\n")
+			var line string = string(s.buf)
+			e.history.add(line)
+			return line, nil
+		case keyCtrlC:
+			fmt.Fprint(e.out, "^C\r\n")
+			return "", errInterrupted
+		case keyCtrlD:
+			if len(s.buf) == 0 {
+				fmt.Fprint(e.out, "\r\n")
+				return "", io.EOF
+			}
+			s.deleteAt(s.pos)
+		case keyBackspace, keyDelete:
+			if s.pos > 0 {
+				s.pos--
+				s.deleteAt(s.pos)
+			}
+		case keyCtrlA:
+			s.pos = 0
+		case keyCtrlE:
+			s.pos = len(s.buf)
+		case keyCtrlU:
+			s.buf = s.buf[s.pos:]
+			s.pos = 0
+		case keyEscape:
+			e.readEscape(s)
+		default:
+			if unicode.IsPrint(r) {
+				s.buf = append(s.buf[:s.pos], append([]rune{r}, s.buf[s.pos:]...)...)
+				s.pos++
+			}
+		}
+
+		e.refresh(s)
+	}
+
+	fmt.Fprint(e.out, "\r\n")
+	return string(s.buf), nil
+}
+
+// readEscape handles the escape sequence sent by an arrow, Home, End or
+// Delete key, and reads past any other sequence without acting on it.
+func (e *editor) readEscape(s *lineState) {
+	introducer, _, err := e.in.ReadRune()
+	if err != nil || (introducer != '[' && introducer != 'O') {
+		return
+	}
+
+	// A sequence may carry parameters before its final byte, which is in
+	// the range 0x40-0x7E: keys like Delete are sent as ESC [ <number> ~,
+	// and modified keys like Ctrl+Right as ESC [ 1 ; 5 C.
+	var params []rune
+	key, _, err := e.in.ReadRune()
+	for err == nil && (key < 0x40 || key > 0x7e) {
+		params = append(params, key)
+		key, _, err = e.in.ReadRune()
+	}
+	if err != nil {
+		return
+	}
+
+	// Sequences the editor does not know, including modified keys, are
+	// ignored.
+	switch string(params) + string(key) {
+	case "A":
+		e.showEntry(s, s.entry-1)
+	case "B":
+		e.showEntry(s, s.entry+1)
+	case "C":
+		if s.pos < len(s.buf) {
+			s.pos++
+		}
+	case "D":
+		if s.pos > 0 {
+			s.pos--
+		}
+	case "H", "1~", "7~":
+		s.pos = 0
+	case "F", "4~", "8~":
+		s.pos = len(s.buf)
+	case "3~":
+		s.deleteAt(s.pos)
+	}
+}
+
+// showEntry replaces the line with history entry i, or with the new line
+// being typed if i is just past the history.
+func (e *editor) showEntry(s *lineState, i int) {
+	if i < 0 || i > len(e.history.lines) || i == s.entry {
+		return
+	}
+
+	if s.entry == len(e.history.lines) {
+		s.pending = s.buf
+	}
+
+	s.entry = i
+	if i == len(e.history.lines) {
+		s.buf = s.pending
+	} else {
+		s.buf = []rune(e.history.lines[i])
+	}
+	s.pos = len(s.buf)
+}
+
+// refresh redraws the line and puts the cursor back in place.
+func (e *editor) refresh(s *lineState) {
+	fmt.Fprintf(e.out, "\r%s%s\x1b[K", s.prompt, string(s.buf))
+
+	if back := len(s.buf) - s.pos; back > 0 {
+		fmt.Fprintf(e.out, "\x1b[%dD", back)
+	}
+}
+
+// deleteAt removes the character at i, if there is one.
+func (s *lineState) deleteAt(i int) {
+	if i < len(s.buf) {
+		s.buf = append(s.buf[:i], s.buf[i+1:]...)
+	}
+}
@@ -0,0 +1,86 @@
+package repl
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// HISTORY_FILE is the name of the history file in the user's home directory.
+const HISTORY_FILE = ".mana_history"
+
+// maxHistory is the number of lines of history that are kept.
+const maxHistory = 1000
+
+// history holds the lines entered at the prompt, oldest first. New lines are
+// appended to a file as well, so that they are available in later sessions.
+type history struct {
+	lines []string
+	path  string // empty if the history is not saved
+}
+
+// historyPath returns the path of the history file, or "" if there is no
+// home directory to keep it in.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, HISTORY_FILE)
+}
+
+// loadHistory reads the history file at path. A missing or unreadable file
+// gives an empty history. If the file has grown past maxHistory lines, it is
+// rewritten with only the most recent ones.
+func loadHistory(path string) *history {
+	var h *history = &history{path: path}
+	if path == "" {
+		return h
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+
+	var scanner *bufio.Scanner = bufio.NewScanner(file)
+	for scanner.Scan() {
+		h.lines = append(h.lines, scanner.Text())
+	}
+	file.Close()
+
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+		os.WriteFile(path, []byte(strings.Join(h.lines, "\n")+"\n"), 0600)
+	}
+
+	return h
+}
+
+// add records a line entered at the prompt. Blank lines and repeats of the
+// previous line are not recorded.
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(h.lines) > 0 && h.lines[len(h.lines)-1] == line {
+		return
+	}
+
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	file.WriteString(line + "\n")
+	file.Close()
+}
@@ -0,0 +1,88 @@
+package repl
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"mana/lexer"
+	"mana/tokens"
+	"strings"
+)
+
+// errInterrupted is returned by a lineReader when the user presses Ctrl-C.
+var errInterrupted = errors.New("interrupted")
+
+// lineReader reads one line of input after showing a prompt.
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// plainReader reads lines from a reader that is not a terminal, such as a
+// pipe. It has no line editing or history.
+type plainReader struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (r *plainReader) ReadLine(prompt string) (string, error) {
+	fmt.Fprint(r.out, prompt)
+
+	line, err := r.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// readInput reads lines until they form a complete input, showing PROMPT for
+// the first line and CONTINUATION_PROMPT for the others. Input that ends
+// in the middle is returned as it is, for the parser to report.
+func readInput(r lineReader) (string, error) {
+	var lines []string
+	var prompt string = PROMPT
+
+	for {
+		line, err := r.ReadLine(prompt)
+		if err == io.EOF && len(lines) > 0 {
+			return strings.Join(lines, "\n"), nil
+		}
+		if err != nil {
+			return "", err
+		}
+
+		lines = append(lines, line)
+
+		var source string = strings.Join(lines, "\n")
+		if !incomplete(source) {
+			return source, nil
+		}
+
+		prompt = CONTINUATION_PROMPT
+	}
+}
+
+// incomplete reports whether source stops inside an unclosed '(', '[' or
+// '{', a string literal or a block comment, so that more lines are needed.
+func incomplete(source string) bool {
+	var l *lexer.Lexer = lexer.New(source)
+	var depth int
+
+	for {
+		var tok tokens.Token = l.NextToken()
+
+		switch tok.Type {
+		case tokens.EOF:
+			return depth > 0
+		case tokens.LPAREN, tokens.LBRACKET, tokens.LBRACE:
+			depth++
+		case tokens.RPAREN, tokens.RBRACKET, tokens.RBRACE:
+			depth--
+		case tokens.ILLEGAL:
+			if tok.Literal == "unterminated string literal" || tok.Literal == "unterminated block comment" {
+				return true
+			}
+		}
+	}
+}
@@ -2,16 +2,19 @@ package repl
 
 import (
 	"bufio"
-	"fmt"
 	"io"
-	"mana/evaluator"
-	"mana/lexer"
 	"mana/object"
 	"mana/parser"
+	"os"
 )
 
 // PROMPT is the prompt for the REPL.
 const PROMPT = ">>> "
+
+// CONTINUATION_PROMPT is the prompt for the following lines of an input that
+// spans several lines.
+const CONTINUATION_PROMPT = "... "
+
 const MANA_START = `
 ███╗░░░███╗░█████╗░███╗░░██╗░█████╗░
 ████╗░████║██╔══██╗████╗░██║██╔══██╗
@@ -21,42 +24,52 @@ const MANA_START = `
 ╚═╝░░░░░╚═╝╚═╝░░╚═╝╚═╝░░╚══╝╚═╝░░╚═╝
 `
 
+// Start runs the REPL until the input ends. An input is read until its
+// brackets, strings and comments are closed, so it can span several lines.
+// If in is a terminal, lines can be edited and the history is kept in
+// HISTORY_FILE in the home directory. Inputs starting with a colon are
+// meta-commands, such as :env to list the bindings of the session.
 func Start(in io.Reader, out io.Writer) {
-	var scanner *bufio.Scanner = bufio.NewScanner(in)
-	env := object.NewEnvironment()
+	var s *session = &session{env: object.NewEnvironment(), out: out}
+	var reader lineReader = newLineReader(in, out)
 
 	io.WriteString(out, MANA_START+"\n")
 
 	for {
-		fmt.Fprint(out, PROMPT)
-		var scanned bool = scanner.Scan()
-
-		if !scanned {
+		source, err := readInput(reader)
+		if err == errInterrupted {
+			continue
+		}
+		if err != nil {
 			return
 		}
 
-		var line string = scanner.Text()
-		var l *lexer.Lexer = lexer.New(line)
-		var p *parser.Parser = parser.New(l)
-
-		var program = p.ParseProgram()
-
-		if len(p.Errors()) != 0 {
-			printParserErrors(out, p.Errors())
+		if isCommand(source) {
+			if !s.runCommand(source) {
+				return
+			}
 			continue
 		}
 
-		evaluated := evaluator.Eval(program, env)
-		if evaluated != nil {
-			io.WriteString(out, evaluated.Inspect())
-			io.WriteString(out, "\n")
-		}
+		s.eval(source)
 	}
 }
 
-func printParserErrors(out io.Writer, errors []string) {
-	io.WriteString(out, "ParseError:\n")
-	for _, msg := range errors {
-		io.WriteString(out, "\t"+msg+"\n")
+// newLineReader returns an editor if in is a terminal, and a plainReader
+// otherwise.
+func newLineReader(in io.Reader, out io.Writer) lineReader {
+	if file, ok := in.(*os.File); ok && isTerminal(int(file.Fd())) {
+		return &editor{
+			in:      bufio.NewReader(in),
+			out:     out,
+			history: loadHistory(historyPath()),
+			raw:     func() (func(), error) { return makeRaw(int(file.Fd())) },
+		}
 	}
+
+	return &plainReader{in: bufio.NewReader(in), out: out}
+}
+
+func printParserErrors(out io.Writer, source string, errors []*parser.Error) {
+	io.WriteString(out, parser.RenderErrors(source, errors))
 }
@@ -0,0 +1,182 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestIncomplete(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"let x = 5;", false},
+		{"let add = fn(a, b) {", true},
+		{"let add = fn(a, b) {\n  a + b\n}", false},
+		{"add(1,", true},
+		{"[1, 2", true},
+		{`let s = "open`, true},
+		{"let s = \"a\nb\"", false},
+		{"/* note", true},
+		{"x }", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		if got := incomplete(tt.input); got != tt.expected {
+			t.Errorf("incomplete(%q) wrong. want=%t, got=%t", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestStartReadsMultiLineInput(t *testing.T) {
+	input := "let add = fn(a, b) {\n  a + b\n};\nadd(1, 2)\n[1,\n 2]"
+	var out bytes.Buffer
+
+	Start(strings.NewReader(input), &out)
+
+	expected := ">>> ... ... >>> 3\n>>> ... [1, 2]\n>>> "
+	if got := strings.TrimPrefix(out.String(), MANA_START+"\n"); got != expected {
+		t.Errorf("wrong output. want=%q, got=%q", expected, got)
+	}
+}
+
+func TestCommands(t *testing.T) {
+	script := filepath.Join(t.TempDir(), "lib.mana")
+	os.WriteFile(script, []byte("let double = fn(x) { x * 2 };"), 0600)
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"let b = 2; const a = 1;\n:env", "const a = 1\nb = 2\n"},
+		{":tokens x += 1", "1:1     IDENT        \"x\"\n1:3     +=           \"+=\"\n1:6     INT          \"1\"\n1:7     EOF          \"\"\n"},
+		{":ast -x", "Program 1:1\n  Statements:\n    ExpressionStatement 1:1\n      Expression: PrefixExpression 1:1 Operator=\"-\"\n        Right: Identifier 1:2 Value=\"x\"\n"},
+		{":type 1.5\n:type [1]\n:type let x = 1", "FLOAT\nARRAY\nno value\n"},
+		{":type y", "ERROR: 1:1: identifier not found: y\n"},
+		{"fn g(x) { x / 0 }\n:type g(4)", "Traceback (most recent call last):\n  File \"<input>\", line 1, column 2, in <main>\n  File \"<input>\", line 1, column 13, in g(4)\nERROR: division by zero: 4 / 0\n"},
+		{":load " + script + "\ndouble(21)", "42\n"},
+		{"let x = 1;\n:reset\n:env\nx", "ERROR: 1:1: identifier not found: x\n"},
+		{"fn f(x) { x / 0 }\nf(3)", "Traceback (most recent call last):\n  File \"<input>\", line 1, column 2, in <main>\n  File \"<input>\", line 1, column 13, in f(3)\nERROR: division by zero: 3 / 0\n"},
+		{":ast", "usage: :ast <source>\n"},
+		{":what", "unknown command: :what (try :env, :tokens, :ast, :type, :load, :reset or :quit)\n"},
+		{":quit\n1", ""},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		Start(strings.NewReader(tt.input), &out)
+
+		got := strings.TrimPrefix(out.String(), MANA_START+"\n")
+		got = strings.ReplaceAll(got, PROMPT, "")
+		if got != tt.expected {
+			t.Errorf("%q: wrong output.\nwant=%q\ngot=%q", tt.input, tt.expected, got)
+		}
+	}
+}
+
+func TestEditor(t *testing.T) {
+	tests := []struct {
+		keys     string
+		history  []string
+		expected []string
+	}{
+		{"abc\r", nil, []string{"abc"}},
+		{"abc\x1b[D\x1b[DX\r", nil, []string{"aXbc"}},
+		{"abc\x7f\x7fd\r", nil, []string{"ad"}},
+		{"abc\x01X\x05Y\r", nil, []string{"XabcY"}},
+		{"abc\x1b[H\x1b[3~\r", nil, []string{"bc"}},
+		{"\x1b[A\r", []string{"old"}, []string{"old"}},
+		{"new\x1b[A\x1b[A\x1b[B\x1b[B\r", []string{"one", "two"}, []string{"new"}},
+		{"\x1b[A\x1b[A!\r", []string{"one", "two"}, []string{"one!"}},
+		{"héllo\x1b[D\x1b[D\x1b[D\x1b[D\x7f\r", nil, []string{"éllo"}},
+		{"ab\x1b[1;5Ccd\r", nil, []string{"abcd"}},
+		{"ab\x1b[1;2Acd\x1bOHX\r", []string{"old"}, []string{"Xabcd"}},
+		{"abc\x1b[15~d\x1b[4~e\r", nil, []string{"abcde"}},
+	}
+
+	for _, tt := range tests {
+		var out bytes.Buffer
+		e := &editor{
+			in:      bufio.NewReader(strings.NewReader(tt.keys)),
+			out:     &out,
+			history: &history{lines: tt.history},
+		}
+
+		var got []string
+		for {
+			line, err := e.ReadLine(PROMPT)
+			if err != nil {
+				break
+			}
+			got = append(got, line)
+		}
+
+		if strings.Join(got, "\n") != strings.Join(tt.expected, "\n") {
+			t.Errorf("%q: wrong lines. want=%q, got=%q", tt.keys, tt.expected, got)
+		}
+	}
+}
+
+func TestEditorCtrlCCancelsInput(t *testing.T) {
+	var out bytes.Buffer
+	e := &editor{
+		in:      bufio.NewReader(strings.NewReader("fn() {\r\x03\"done\"\r")),
+		out:     &out,
+		history: &history{},
+	}
+
+	if _, err := readInput(e); err != errInterrupted {
+		t.Fatalf("expected errInterrupted, got=%v", err)
+	}
+
+	source, err := readInput(e)
+	if err != nil || source != `"done"` {
+		t.Errorf("wrong input after Ctrl-C. got=%q (%v)", source, err)
+	}
+}
+
+func TestHistoryPersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	h := loadHistory(path)
+	h.add("let x = 1")
+	h.add("let x = 1")
+	h.add("   ")
+	h.add("x + 1")
+
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("history file not written: %s", err)
+	}
+	if string(contents) != "let x = 1\nx + 1\n" {
+		t.Errorf("wrong history file. got=%q", contents)
+	}
+
+	if got := loadHistory(path).lines; strings.Join(got, "\n") != "let x = 1\nx + 1" {
+		t.Errorf("wrong history loaded. got=%q", got)
+	}
+}
+
+func TestHistoryIsTrimmed(t *testing.T) {
+	path := filepath.Join(t.TempDir(), HISTORY_FILE)
+
+	var lines []string
+	for i := 0; i < maxHistory+10; i++ {
+		lines = append(lines, strings.Repeat("x", i+1))
+	}
+	os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0600)
+
+	h := loadHistory(path)
+	if len(h.lines) != maxHistory || h.lines[0] != lines[10] {
+		t.Fatalf("wrong history loaded. got %d lines", len(h.lines))
+	}
+
+	if got := loadHistory(path).lines; len(got) != maxHistory {
+		t.Errorf("history file not trimmed. got %d lines", len(got))
+	}
+}
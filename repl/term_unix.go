@@ -0,0 +1,53 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd
+
+package repl
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// isTerminal reports whether fd refers to a terminal.
+func isTerminal(fd int) bool {
+	var termios syscall.Termios
+	return getTermios(fd, &termios) == nil
+}
+
+// makeRaw puts the terminal fd into raw mode, in which keys are read one at a
+// time without echo and Ctrl-C arrives as a byte instead of a signal. The
+// returned function restores the previous mode.
+func makeRaw(fd int) (func(), error) {
+	var old syscall.Termios
+	if err := getTermios(fd, &old); err != nil {
+		return nil, err
+	}
+
+	raw := old
+	raw.Iflag &^= syscall.BRKINT | syscall.ICRNL | syscall.INPCK | syscall.ISTRIP | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ICANON | syscall.IEXTEN | syscall.ISIG
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+
+	if err := setTermios(fd, &raw); err != nil {
+		return nil, err
+	}
+
+	return func() { setTermios(fd, &old) }, nil
+}
+
+func getTermios(fd int, termios *syscall.Termios) error {
+	return ioctl(fd, ioctlGetTermios, termios)
+}
+
+func setTermios(fd int, termios *syscall.Termios) error {
+	return ioctl(fd, ioctlSetTermios, termios)
+}
+
+func ioctl(fd int, request uintptr, termios *syscall.Termios) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), request, uintptr(unsafe.Pointer(termios)))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
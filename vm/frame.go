@@ -0,0 +1,27 @@
+package vm
+
+import (
+	"mana/code"
+	"mana/object"
+)
+
+// Frame is the activation record of a running closure.
+type Frame struct {
+	cl          *object.Closure
+	ip          int
+	basePointer int
+
+	// args holds the arguments of the call, for the Frames of an error.
+	// The parameter slots cannot be used, since the body may assign to them.
+	args []object.Object
+}
+
+// NewFrame returns a frame for cl whose locals start at basePointer.
+func NewFrame(cl *object.Closure, basePointer int) *Frame {
+	return &Frame{cl: cl, ip: -1, basePointer: basePointer}
+}
+
+// Instructions returns the bytecode the frame executes.
+func (f *Frame) Instructions() code.Instructions {
+	return f.cl.Fn.Instructions
+}
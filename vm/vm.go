@@ -0,0 +1,697 @@
+package vm
+
+import (
+	"fmt"
+	"mana/code"
+	"mana/compiler"
+	"mana/evaluator"
+	"mana/object"
+)
+
+const (
+	// StackSize is the initial number of stack slots. The stack grows on
+	// demand, without a limit of its own: the depth of calls is bounded by
+	// MaxFrames instead, so that it is the same as on the evaluator however
+	// many locals each call has.
+	StackSize = 2048
+
+	// GlobalsSize is the initial number of global slots.
+	GlobalsSize = 256
+
+	// MaxFrames bounds the call depth. The main program takes up one frame,
+	// so functions can nest as deeply as on the evaluator.
+	MaxFrames = evaluator.MaxCallDepth + 1
+)
+
+// VM executes the bytecode produced by the compiler. Values and errors are
+// computed by the evaluator's operations, so a program behaves the same on
+// either backend.
+type VM struct {
+	constants []object.Object
+
+	globals     []object.Object
+	globalNames []string
+	// globalIndexes maps global names to slots. It is built the first time
+	// a variable falls back to a global by name.
+	globalIndexes map[string]int
+	// constGlobals marks the global slots bound by a const statement.
+	constGlobals map[int]bool
+
+	stack []object.Object
+	sp    int // always points to the next free slot; top of stack is stack[sp-1]
+
+	frames      []*Frame
+	framesIndex int
+
+	// openUpvalues holds the upvalues that still refer to stack slots.
+	openUpvalues []*object.Upvalue
+}
+
+// New returns a VM ready to run bytecode.
+func New(bytecode *compiler.Bytecode) *VM {
+	return NewWithGlobals(bytecode, make([]object.Object, GlobalsSize))
+}
+
+// NewWithGlobals returns a VM that shares the given global slots, so that
+// state carries over between runs as it does in the REPL.
+func NewWithGlobals(bytecode *compiler.Bytecode, globals []object.Object) *VM {
+	mainFn := &object.CompiledFunction{
+		Instructions: bytecode.Instructions,
+		Positions:    bytecode.Positions,
+		Name:         "<main>",
+	}
+	mainClosure := &object.Closure{Fn: mainFn}
+	mainFrame := NewFrame(mainClosure, 0)
+
+	frames := make([]*Frame, 1, 64)
+	frames[0] = mainFrame
+
+	return &VM{
+		constants:    bytecode.Constants,
+		globals:      globals,
+		globalNames:  bytecode.GlobalNames,
+		constGlobals: map[int]bool{},
+		stack:        make([]object.Object, StackSize),
+		sp:           0,
+		frames:       frames,
+		framesIndex:  1,
+	}
+}
+
+// Globals returns the global slots, to be passed to NewWithGlobals.
+func (vm *VM) Globals() []object.Object {
+	return vm.globals
+}
+
+// SetGlobal stores value in the global slot index.
+func (vm *VM) SetGlobal(index int, value object.Object) {
+	vm.growGlobals(index)
+	vm.globals[index] = value
+}
+
+// LastPoppedStackElem returns the value of the last expression statement
+// executed, which is the result of the program. It is nil if the program
+// ended in a statement that produces no value.
+func (vm *VM) LastPoppedStackElem() object.Object {
+	return vm.stack[vm.sp]
+}
+
+// Run executes the program. A runtime error is returned as an *object.Error
+// positioned at the node it was raised by.
+func (vm *VM) Run() error {
+	var ip int
+	var ins code.Instructions
+	var op code.Opcode
+
+	for vm.currentFrame().ip < len(vm.currentFrame().Instructions())-1 {
+		vm.currentFrame().ip++
+
+		ip = vm.currentFrame().ip
+		ins = vm.currentFrame().Instructions()
+		op = code.Opcode(ins[ip])
+
+		if err := vm.execute(op, ins, ip); err != nil {
+			return vm.traced(vm.positioned(err, ip))
+		}
+	}
+
+	return nil
+}
+
+func (vm *VM) execute(op code.Opcode, ins code.Instructions, ip int) error {
+	frame := vm.currentFrame()
+
+	switch op {
+	case code.OpConstant:
+		constIndex := code.ReadUint16(ins[ip+1:])
+		frame.ip += 2
+
+		return vm.push(vm.constants[constIndex])
+
+	case code.OpPop:
+		vm.pop()
+
+	case code.OpDupTwo:
+		if err := vm.push(vm.stack[vm.sp-2]); err != nil {
+			return err
+		}
+		return vm.push(vm.stack[vm.sp-2])
+
+	case code.OpAdd, code.OpSub, code.OpMul, code.OpDiv, code.OpMod,
+		code.OpEqual, code.OpNotEqual, code.OpGreaterThan, code.OpLessThan,
+		code.OpGreaterEqual, code.OpLessEqual:
+		right := vm.pop()
+		left := vm.pop()
+
+		return vm.pushResult(evaluator.InfixOperation(infixOperators[op], left, right))
+
+	case code.OpMinus:
+		return vm.pushResult(evaluator.PrefixOperation("-", vm.pop()))
+
+	case code.OpBang:
+		return vm.pushResult(evaluator.PrefixOperation("!", vm.pop()))
+
+	case code.OpTrue:
+		return vm.push(evaluator.TRUE)
+
+	case code.OpFalse:
+		return vm.push(evaluator.FALSE)
+
+	case code.OpNull:
+		return vm.push(evaluator.NULL)
+
+	case code.OpNil:
+		return vm.push(nil)
+
+	case code.OpJump:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip = pos - 1
+
+	case code.OpJumpNotTruthy:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		condition := vm.pop()
+		if !evaluator.IsTruthy(condition) {
+			frame.ip = pos - 1
+		}
+
+	case code.OpJumpIfFalsy, code.OpJumpIfTruthy, code.OpJumpIfNotNull:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		if _, decided := evaluator.ShortCircuit(logicalOperators[op], vm.stack[vm.sp-1]); decided {
+			frame.ip = pos - 1
+		} else {
+			vm.pop()
+		}
+
+	case code.OpIterator:
+		values, err := evaluator.IterationValues(vm.pop())
+		if err != nil {
+			return err
+		}
+		return vm.push(&object.Iterator{Values: values})
+
+	case code.OpIterNext:
+		pos := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		iterator := vm.stack[vm.sp-1].(*object.Iterator)
+		if iterator.Next >= len(iterator.Values) {
+			frame.ip = pos - 1
+			return nil
+		}
+
+		iterator.Next++
+		return vm.push(iterator.Values[iterator.Next-1])
+
+	case code.OpSetGlobal:
+		globalIndex := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		if vm.constGlobals[globalIndex] {
+			return newError("cannot redeclare constant: %s", vm.globalNames[globalIndex])
+		}
+		vm.SetGlobal(globalIndex, vm.pop())
+
+	case code.OpSetConstGlobal:
+		globalIndex := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		if vm.constGlobals[globalIndex] {
+			return newError("cannot redeclare constant: %s", vm.globalNames[globalIndex])
+		}
+		vm.SetGlobal(globalIndex, vm.pop())
+		vm.constGlobals[globalIndex] = true
+
+	case code.OpGetGlobal:
+		globalIndex := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		return vm.getGlobal(globalIndex)
+
+	case code.OpSetLocal:
+		localIndex := int(code.ReadUint8(ins[ip+1:]))
+		frame.ip += 1
+
+		vm.stack[frame.basePointer+localIndex] = vm.pop()
+
+	case code.OpGetLocal:
+		localIndex := int(code.ReadUint8(ins[ip+1:]))
+		frame.ip += 1
+
+		value := vm.stack[frame.basePointer+localIndex]
+		if value == nil {
+			return vm.getFallback(frame.cl, frame.cl.Fn.LocalFallbacks, localIndex, frame.cl.Fn.LocalNames[localIndex])
+		}
+		return vm.push(value)
+
+	case code.OpGetFree:
+		freeIndex := int(code.ReadUint8(ins[ip+1:]))
+		frame.ip += 1
+
+		value := vm.upvalue(frame.cl.Free[freeIndex])
+		if value == nil {
+			return vm.getFallback(frame.cl, frame.cl.Fn.FreeFallbacks, freeIndex, frame.cl.Fn.Free[freeIndex].Name)
+		}
+		return vm.push(value)
+
+	case code.OpAssignGlobal:
+		globalIndex := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		return vm.assignGlobal(globalIndex, vm.stack[vm.sp-1])
+
+	case code.OpAssignLocal:
+		localIndex := int(code.ReadUint8(ins[ip+1:]))
+		frame.ip += 1
+
+		if vm.stack[frame.basePointer+localIndex] == nil {
+			return vm.assignFallback(frame.cl, frame.cl.Fn.LocalFallbacks, localIndex, frame.cl.Fn.LocalNames[localIndex], vm.stack[vm.sp-1])
+		}
+		vm.stack[frame.basePointer+localIndex] = vm.stack[vm.sp-1]
+
+	case code.OpAssignFree:
+		freeIndex := int(code.ReadUint8(ins[ip+1:]))
+		frame.ip += 1
+
+		uv := frame.cl.Free[freeIndex]
+		if vm.upvalue(uv) == nil {
+			return vm.assignFallback(frame.cl, frame.cl.Fn.FreeFallbacks, freeIndex, frame.cl.Fn.Free[freeIndex].Name, vm.stack[vm.sp-1])
+		}
+		vm.setUpvalue(uv, vm.stack[vm.sp-1])
+
+	case code.OpArray:
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		elements := make([]object.Object, numElements)
+		copy(elements, vm.stack[vm.sp-numElements:vm.sp])
+		vm.sp = vm.sp - numElements
+
+		return vm.push(&object.Array{Elements: elements})
+
+	case code.OpHash:
+		numElements := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		pairs := make([]object.HashPair, 0, numElements/2)
+		for i := vm.sp - numElements; i < vm.sp; i += 2 {
+			pairs = append(pairs, object.HashPair{Key: vm.stack[i], Value: vm.stack[i+1]})
+		}
+		vm.sp = vm.sp - numElements
+
+		return vm.pushResult(evaluator.HashOperation(pairs))
+
+	case code.OpIndex:
+		index := vm.pop()
+		left := vm.pop()
+
+		return vm.pushResult(evaluator.IndexOperation(left, index))
+
+	case code.OpSetIndex:
+		value := vm.pop()
+		index := vm.pop()
+		left := vm.pop()
+
+		return vm.pushResult(evaluator.SetIndexOperation(left, index, value))
+
+	case code.OpCall:
+		numArgs := int(code.ReadUint8(ins[ip+1:]))
+		frame.ip += 1
+
+		return vm.executeCall(numArgs)
+
+	case code.OpReturnValue:
+		returnValue := vm.pop()
+		vm.returnFromFrame()
+
+		return vm.push(returnValue)
+
+	case code.OpReturn:
+		vm.returnFromFrame()
+
+		return vm.push(evaluator.NULL)
+
+	case code.OpClosure:
+		constIndex := int(code.ReadUint16(ins[ip+1:]))
+		frame.ip += 2
+
+		return vm.pushClosure(constIndex)
+
+	default:
+		return fmt.Errorf("unknown opcode %d", op)
+	}
+
+	return nil
+}
+
+var infixOperators = map[code.Opcode]string{
+	code.OpAdd:          "+",
+	code.OpSub:          "-",
+	code.OpMul:          "*",
+	code.OpDiv:          "/",
+	code.OpMod:          "%",
+	code.OpEqual:        "==",
+	code.OpNotEqual:     "!=",
+	code.OpGreaterThan:  ">",
+	code.OpLessThan:     "<",
+	code.OpGreaterEqual: ">=",
+	code.OpLessEqual:    "<=",
+}
+
+var logicalOperators = map[code.Opcode]string{
+	code.OpJumpIfFalsy:   "&&",
+	code.OpJumpIfTruthy:  "||",
+	code.OpJumpIfNotNull: "??",
+}
+
+// positioned attributes an error raised by the instruction at ip of the
+// current frame to the source position it was compiled from.
+func (vm *VM) positioned(err error, ip int) error {
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		return err
+	}
+
+	if !errObj.Pos.IsValid() {
+		errObj.Pos = vm.currentFrame().cl.Fn.Positions.Lookup(ip)
+	}
+
+	return errObj
+}
+
+// traced records the calls that are active when a runtime error is raised in
+// its Frames, the innermost call first.
+func (vm *VM) traced(err error) error {
+	errObj, ok := err.(*object.Error)
+	if !ok {
+		return err
+	}
+
+	for i := vm.framesIndex - 1; i > 0; i-- {
+		frame, caller := vm.frames[i], vm.frames[i-1]
+
+		var name string = frame.cl.Fn.Name
+		if name == "" {
+			name = "<anonymous>"
+		}
+
+		errObj.Frames = append(errObj.Frames, object.Frame{
+			Function: name,
+			Pos:      caller.cl.Fn.Positions.Lookup(caller.ip),
+			Args:     object.ArgsSummary(frame.args),
+		})
+	}
+
+	return errObj
+}
+
+func (vm *VM) getGlobal(index int) error {
+	var value object.Object
+	if index < len(vm.globals) {
+		value = vm.globals[index]
+	}
+
+	if value == nil {
+		name := vm.globalNames[index]
+		if builtin, ok := evaluator.LookupBuiltin(name); ok {
+			return vm.push(builtin)
+		}
+		return identifierNotFound(name)
+	}
+
+	return vm.push(value)
+}
+
+// assignGlobal assigns value to the global slot index, which must already
+// be set.
+func (vm *VM) assignGlobal(index int, value object.Object) error {
+	if index >= len(vm.globals) || vm.globals[index] == nil {
+		return assignmentToUndeclared(vm.globalNames[index])
+	}
+	if vm.constGlobals[index] {
+		return newError("cannot assign to constant: %s", vm.globalNames[index])
+	}
+	vm.globals[index] = value
+	return nil
+}
+
+// getFallback pushes what a read of the unset variable name, slot index of
+// the given fallbacks of cl, finds instead. Like the evaluator, which goes on
+// to the enclosing scopes, it reads the first set free variable down the
+// chain of fallbacks, or else the global or builtin called name.
+func (vm *VM) getFallback(cl *object.Closure, fallbacks map[int]int, index int, name string) error {
+	free, ok := fallbacks[index]
+	for ok {
+		if value := vm.upvalue(cl.Free[free]); value != nil {
+			return vm.push(value)
+		}
+		free, ok = cl.Fn.FreeFallbacks[free]
+	}
+
+	if index, ok := vm.globalIndex(name); ok {
+		return vm.getGlobal(index)
+	}
+	if builtin, ok := evaluator.LookupBuiltin(name); ok {
+		return vm.push(builtin)
+	}
+	return identifierNotFound(name)
+}
+
+// assignFallback assigns value to what getFallback would read instead of the
+// unset variable name.
+func (vm *VM) assignFallback(cl *object.Closure, fallbacks map[int]int, index int, name string, value object.Object) error {
+	free, ok := fallbacks[index]
+	for ok {
+		if uv := cl.Free[free]; vm.upvalue(uv) != nil {
+			vm.setUpvalue(uv, value)
+			return nil
+		}
+		free, ok = cl.Fn.FreeFallbacks[free]
+	}
+
+	if index, ok := vm.globalIndex(name); ok {
+		return vm.assignGlobal(index, value)
+	}
+	return assignmentToUndeclared(name)
+}
+
+// globalIndex returns the slot of the global called name, if the program
+// has one.
+func (vm *VM) globalIndex(name string) (int, bool) {
+	if vm.globalIndexes == nil {
+		vm.globalIndexes = make(map[string]int, len(vm.globalNames))
+		for i, n := range vm.globalNames {
+			vm.globalIndexes[n] = i
+		}
+	}
+
+	index, ok := vm.globalIndexes[name]
+	return index, ok
+}
+
+func (vm *VM) growGlobals(index int) {
+	if index < len(vm.globals) {
+		return
+	}
+
+	size := 2 * len(vm.globals)
+	if size <= index {
+		size = index + 1
+	}
+
+	globals := make([]object.Object, size)
+	copy(globals, vm.globals)
+	vm.globals = globals
+}
+
+func (vm *VM) executeCall(numArgs int) error {
+	callee := vm.stack[vm.sp-1-numArgs]
+
+	switch callee := callee.(type) {
+	case *object.Closure:
+		return vm.callClosure(callee, numArgs)
+	case *object.Builtin:
+		return vm.callBuiltin(callee, numArgs)
+	default:
+		return newError("not a function: %s", callee.Type())
+	}
+}
+
+func (vm *VM) callClosure(cl *object.Closure, numArgs int) error {
+	if numArgs != cl.Fn.NumParameters {
+		return newError("wrong number of arguments: want=%d, got=%d", cl.Fn.NumParameters, numArgs)
+	}
+
+	if vm.framesIndex >= MaxFrames {
+		return newError("stack overflow")
+	}
+
+	basePointer := vm.sp - numArgs
+	vm.ensureStack(basePointer + cl.Fn.NumLocals)
+
+	// Locals that are not parameters start out unset; the slots may still
+	// hold values from an earlier call.
+	for i := basePointer + numArgs; i < basePointer+cl.Fn.NumLocals; i++ {
+		vm.stack[i] = nil
+	}
+
+	frame := NewFrame(cl, basePointer)
+	frame.args = make([]object.Object, numArgs)
+	copy(frame.args, vm.stack[basePointer:basePointer+numArgs])
+
+	vm.pushFrame(frame)
+	vm.sp = basePointer + cl.Fn.NumLocals
+
+	return nil
+}
+
+func (vm *VM) callBuiltin(builtin *object.Builtin, numArgs int) error {
+	args := make([]object.Object, numArgs)
+	copy(args, vm.stack[vm.sp-numArgs:vm.sp])
+
+	result := evaluator.ValueOrNull(builtin.Fn(args...))
+	vm.sp = vm.sp - numArgs - 1
+
+	return vm.pushResult(result)
+}
+
+func (vm *VM) returnFromFrame() {
+	frame := vm.popFrame()
+	vm.closeUpvalues(frame.basePointer)
+	vm.sp = frame.basePointer - 1
+}
+
+func (vm *VM) pushClosure(constIndex int) error {
+	function, ok := vm.constants[constIndex].(*object.CompiledFunction)
+	if !ok {
+		return fmt.Errorf("not a function: %+v", vm.constants[constIndex])
+	}
+
+	frame := vm.currentFrame()
+	free := make([]*object.Upvalue, len(function.Free))
+	for i, fv := range function.Free {
+		if fv.IsLocal {
+			free[i] = vm.captureUpvalue(frame.basePointer + fv.Index)
+		} else {
+			free[i] = frame.cl.Free[fv.Index]
+		}
+	}
+
+	return vm.push(&object.Closure{Fn: function, Free: free})
+}
+
+// captureUpvalue returns the open upvalue for a stack slot, creating it if no
+// closure has captured the slot yet.
+func (vm *VM) captureUpvalue(slot int) *object.Upvalue {
+	for _, uv := range vm.openUpvalues {
+		if uv.Slot == slot {
+			return uv
+		}
+	}
+
+	uv := &object.Upvalue{Slot: slot}
+	vm.openUpvalues = append(vm.openUpvalues, uv)
+	return uv
+}
+
+// closeUpvalues closes every open upvalue that refers to a slot at or above
+// base, which belong to a frame that is returning.
+func (vm *VM) closeUpvalues(base int) {
+	open := vm.openUpvalues[:0]
+	for _, uv := range vm.openUpvalues {
+		if uv.Slot >= base {
+			uv.Close(vm.stack[uv.Slot])
+		} else {
+			open = append(open, uv)
+		}
+	}
+	vm.openUpvalues = open
+}
+
+func (vm *VM) upvalue(uv *object.Upvalue) object.Object {
+	if uv.IsOpen() {
+		return vm.stack[uv.Slot]
+	}
+	return uv.Value
+}
+
+func (vm *VM) setUpvalue(uv *object.Upvalue, value object.Object) {
+	if uv.IsOpen() {
+		vm.stack[uv.Slot] = value
+	} else {
+		uv.Value = value
+	}
+}
+
+func (vm *VM) currentFrame() *Frame {
+	return vm.frames[vm.framesIndex-1]
+}
+
+func (vm *VM) pushFrame(f *Frame) {
+	if vm.framesIndex < len(vm.frames) {
+		vm.frames[vm.framesIndex] = f
+	} else {
+		vm.frames = append(vm.frames, f)
+	}
+	vm.framesIndex++
+}
+
+func (vm *VM) popFrame() *Frame {
+	vm.framesIndex--
+	return vm.frames[vm.framesIndex]
+}
+
+// pushResult pushes the result of an operation, or returns it if it is an
+// error.
+func (vm *VM) pushResult(result object.Object) error {
+	if errObj, ok := result.(*object.Error); ok {
+		return errObj
+	}
+	return vm.push(result)
+}
+
+func (vm *VM) push(o object.Object) error {
+	vm.ensureStack(vm.sp + 1)
+
+	vm.stack[vm.sp] = o
+	vm.sp++
+
+	return nil
+}
+
+func (vm *VM) pop() object.Object {
+	o := vm.stack[vm.sp-1]
+	vm.sp--
+	return o
+}
+
+// ensureStack grows the stack so that it has at least size slots.
+func (vm *VM) ensureStack(size int) {
+	if size <= len(vm.stack) {
+		return
+	}
+
+	newSize := 2 * len(vm.stack)
+	for newSize < size {
+		newSize *= 2
+	}
+
+	stack := make([]object.Object, newSize)
+	copy(stack, vm.stack)
+	vm.stack = stack
+}
+
+func identifierNotFound(name string) error {
+	return newError("identifier not found: %s", name)
+}
+
+func assignmentToUndeclared(name string) error {
+	return newError("assignment to undeclared variable: %s", name)
+}
+
+func newError(format string, a ...interface{}) *object.Error {
+	return &object.Error{Message: fmt.Sprintf(format, a...)}
+}
@@ -0,0 +1,88 @@
+package vm
+
+import (
+	"mana/ast"
+	"mana/compiler"
+	"mana/lexer"
+	"mana/object"
+	"mana/parser"
+	"testing"
+)
+
+func TestDeepRecursionGrowsStack(t *testing.T) {
+	input := `
+let sum = fn(n) { if (n == 0) { 0 } else { n + sum(n - 1) } };
+sum(5000)
+`
+	result, err := run(t, input)
+	if err != nil {
+		t.Fatalf("vm error: %s", err)
+	}
+
+	integer, ok := result.(*object.Integer)
+	if !ok || integer.Value != 12502500 {
+		t.Errorf("wrong result. got=%+v", result)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	_, err := run(t, "let f = fn() { 1 + f() }; f()")
+	if err == nil {
+		t.Fatalf("expected an error")
+	}
+
+	if err.Error() != "1:21: stack overflow" {
+		t.Errorf("wrong error. got=%q", err.Error())
+	}
+}
+
+func TestGlobalsPersist(t *testing.T) {
+	symbolTable := compiler.NewSymbolTable()
+	constants := []object.Object{}
+	globals := make([]object.Object, GlobalsSize)
+
+	for i, input := range []string{"let a = 40;", "let b = a + 2;", "b"} {
+		comp := compiler.NewWithState(symbolTable, constants)
+		if err := comp.Compile(parse(input)); err != nil {
+			t.Fatalf("compiler error: %s", err)
+		}
+
+		bytecode := comp.Bytecode()
+		constants = bytecode.Constants
+
+		machine := NewWithGlobals(bytecode, globals)
+		if err := machine.Run(); err != nil {
+			t.Fatalf("vm error: %s", err)
+		}
+		globals = machine.Globals()
+
+		if i == 2 {
+			integer, ok := machine.LastPoppedStackElem().(*object.Integer)
+			if !ok || integer.Value != 42 {
+				t.Errorf("wrong result. got=%+v", machine.LastPoppedStackElem())
+			}
+		}
+	}
+}
+
+func parse(input string) *ast.Program {
+	l := lexer.New(input)
+	p := parser.New(l)
+	return p.ParseProgram()
+}
+
+func run(t *testing.T, input string) (object.Object, error) {
+	t.Helper()
+
+	comp := compiler.New()
+	if err := comp.Compile(parse(input)); err != nil {
+		t.Fatalf("compiler error: %s", err)
+	}
+
+	machine := New(comp.Bytecode())
+	if err := machine.Run(); err != nil {
+		return nil, err
+	}
+
+	return machine.LastPoppedStackElem(), nil
+}